@@ -0,0 +1,160 @@
+// Command mqbridge forwards messages between POSIX message queues on different hosts over TCP.
+//
+// On the sending host, messages received from the queue are forwarded to the peer:
+//
+//	mqbridge -mode send -queue /orders -addr peer:7400
+//
+// On the receiving host, forwarded messages are sent to the queue with their original priority:
+//
+//	mqbridge -mode recv -queue /orders -addr :7400
+//
+// TLS is enabled by passing -cert and -key, and -ca to verify the peer. A receiver given -ca requires
+// client certificates.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/posixmq"
+	"github.com/bobcatalyst/go-mq/posixmq/bridge"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// options are the command line flags.
+type options struct {
+	mode, queue, addr          string
+	create                     bool
+	queueMode, msgSize, maxMsg int
+	window                     int
+	certFile, keyFile, caFile  string
+	serverName                 string
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.mode, "mode", "", "send to forward messages from the queue, recv to deliver them to the queue")
+	flag.StringVar(&o.queue, "queue", "", "name of the queue")
+	flag.StringVar(&o.addr, "addr", "", "address of the peer when sending, address to listen on when receiving")
+	flag.BoolVar(&o.create, "create", false, "create the queue if it does not exist")
+	flag.IntVar(&o.queueMode, "queue-mode", 0600, "mode of a created queue")
+	flag.IntVar(&o.msgSize, "msgsize", 0, "max message size of a created queue, 0 for the system default")
+	flag.IntVar(&o.maxMsg, "maxmsg", 0, "max messages in a created queue, 0 for the system default")
+	flag.IntVar(&o.window, "window", 64, "unacknowledged messages held by the sender")
+	flag.StringVar(&o.certFile, "cert", "", "TLS certificate")
+	flag.StringVar(&o.keyFile, "key", "", "TLS key")
+	flag.StringVar(&o.caFile, "ca", "", "CA certificates used to verify the peer")
+	flag.StringVar(&o.serverName, "server-name", "", "name expected in the receiver's certificate, defaults to the host of -addr")
+	flag.Parse()
+
+	if err := run(o); err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatal(err)
+	}
+}
+
+func run(o options) error {
+	if o.queue == "" || o.addr == "" {
+		return errors.New("-queue and -addr are required")
+	}
+
+	oflag := posixmq.OpenReadOnly
+	if o.mode == "recv" {
+		oflag = posixmq.OpenWriteOnly
+	} else if o.mode != "send" {
+		return fmt.Errorf("unknown mode %q, expected send or recv", o.mode)
+	}
+	opts := []posixmq.MQOption{posixmq.OptionOflag(oflag | posixmq.OpenCloseOnExec)}
+	if o.create {
+		var err error
+		if o.msgSize == 0 {
+			if o.msgSize, err = posixmq.DefaultMessageSize(); err != nil {
+				return err
+			}
+		}
+		if o.maxMsg == 0 {
+			if o.maxMsg, err = posixmq.DefaultQueueSize(); err != nil {
+				return err
+			}
+		}
+		opts = append(opts, posixmq.OptionCreateArgs(o.queueMode, o.msgSize, o.maxMsg))
+	}
+	mq, err := posixmq.New(o.queue, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to open queue %s: %w", o.queue, err)
+	}
+	defer mq.Close()
+
+	bopts := []bridge.Option{
+		bridge.OptionWindow(o.window),
+		bridge.OptionOnError(func(err error) { log.Print(err) }),
+	}
+	if tlsConfig, err := loadTLS(o); err != nil {
+		return err
+	} else if tlsConfig != nil {
+		bopts = append(bopts, bridge.OptionTLS(tlsConfig))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if o.mode == "send" {
+		return bridge.NewSender(mq, o.addr, bopts...).Run(ctx)
+	}
+	l, err := net.Listen("tcp", o.addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("delivering to %s from %s", o.queue, l.Addr())
+	return bridge.NewReceiver(mq, bopts...).Serve(ctx, l)
+}
+
+// loadTLS builds the TLS config, or returns nil if no TLS files were given.
+func loadTLS(o options) (*tls.Config, error) {
+	if o.certFile == "" && o.keyFile == "" && o.caFile == "" {
+		return nil, nil
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if o.certFile != "" || o.keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.certFile, o.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	var pool *x509.CertPool
+	if o.caFile != "" {
+		pem, err := os.ReadFile(o.caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", o.caFile)
+		}
+	}
+
+	if o.mode == "send" {
+		config.RootCAs = pool
+		if config.ServerName = o.serverName; o.serverName == "" {
+			if config.ServerName, _, _ = net.SplitHostPort(o.addr); config.ServerName == "" {
+				config.ServerName = o.addr
+			}
+		}
+	} else {
+		if len(config.Certificates) == 0 {
+			return nil, errors.New("-cert and -key are required to receive with TLS")
+		}
+		if pool != nil {
+			config.ClientCAs = pool
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return config, nil
+}
@@ -0,0 +1,100 @@
+// Command mqctl inspects POSIX message queues.
+//
+// The snapshot action lists the messages in a queue without consuming them, in the order they would be received:
+//
+//	mqctl snapshot /orders
+//	mqctl snapshot -o orders.mqrec /orders
+//
+// A snapshot written with -o can be sent to a queue again with the record package's Replay.
+// If the messages can't all be sent back to the queue, the rest are written to the -spill file,
+// or a new file in the temporary directory, and mqctl exits with an error naming it.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"github.com/bobcatalyst/go-mq/posixmq"
+	"github.com/bobcatalyst/go-mq/posixmq/record"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// actions are the subcommands, each given the arguments after its name.
+var actions = map[string]func(args []string) error{
+	"snapshot": snapshot,
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 || actions[os.Args[1]] == nil {
+		log.Fatalf("usage: mqctl <action> [flags]\nactions: %s", strings.Join(slices.Sorted(maps.Keys(actions)), ", "))
+	}
+	if err := actions[os.Args[1]](os.Args[2:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func snapshot(args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	out := fs.String("o", "", "write the snapshot as a recording instead of listing it")
+	spill := fs.String("spill", "", "where to write messages that can't be sent back, defaults to a temporary file")
+	timeout := fs.Duration("timeout", time.Second*5, "how long to wait for the lock and for space in the queue")
+	maxData := fs.Int("max-data", 64, "bytes of each message to list, 0 for all")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: mqctl snapshot [flags] <queue>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	mq, err := posixmq.New(fs.Arg(0), posixmq.OptionOflag(posixmq.OpenReadWrite|posixmq.OpenCloseOnExec))
+	if err != nil {
+		return fmt.Errorf("failed to open queue %s: %w", fs.Arg(0), err)
+	}
+	defer mq.Close()
+
+	var opts []record.SnapshotOption
+	if *spill != "" {
+		opts = append(opts, record.SnapshotSpill(*spill))
+	}
+	records, snapErr := record.Snapshot(deadline.TimeDeadline(time.Now().Add(*timeout)), mq, opts...)
+	// The snapshot is still reported if sending it back failed.
+	if snapErr != nil && !errors.As(snapErr, new(record.ErrReinject)) {
+		return snapErr
+	}
+
+	if *out != "" {
+		return errors.Join(snapErr, writeRecording(*out, records))
+	}
+	for i, rec := range records {
+		data := rec.Data
+		if *maxData > 0 && len(data) > *maxData {
+			data = data[:*maxData]
+		}
+		fmt.Printf("%d\tpriority=%d\tsize=%d\t%q\n", i, rec.Priority, len(rec.Data), data)
+	}
+	return snapErr
+}
+
+func writeRecording(path string, records []record.Record) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := record.NewWriter(f)
+	for _, rec := range records {
+		if err := w.Write(rec); err != nil {
+			return errors.Join(err, f.Close())
+		}
+	}
+	return errors.Join(w.Flush(), f.Close())
+}
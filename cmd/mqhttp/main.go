@@ -0,0 +1,56 @@
+// Command mqhttp serves POSIX message queues over HTTP, see package mqhttp for the routes.
+//
+//	mqhttp -addr 127.0.0.1:8080
+//	curl -X PUT localhost:8080/queues/orders
+//	curl --data-binary hello 'localhost:8080/queues/orders/messages?priority=3'
+//	curl 'localhost:8080/queues/orders/messages?timeout=30s'
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"github.com/bobcatalyst/go-mq/posixmq/mqhttp"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "address to listen on, queues are served without authentication")
+	maxWait := flag.Duration("max-wait", time.Minute, "longest a receive waits for a message")
+	mode := flag.Int("mode", 0600, "mode of created queues when the request does not give one")
+	flag.Parse()
+
+	if err := run(*addr, mqhttp.NewHandler(mqhttp.OptionMaxWait(*maxWait), mqhttp.OptionCreateMode(*mode))); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(addr string, h http.Handler) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{Addr: addr, Handler: h}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	log.Printf("serving queues on %s", addr)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	// Long-polling receives notice the cancelled request and return within a poll interval.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	} else if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
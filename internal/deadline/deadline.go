@@ -1,10 +1,14 @@
 package deadline
 
 import (
+	"context"
 	"golang.org/x/sys/unix"
 	"time"
 )
 
+// PollInterval bounds blocking queue operations that run until a context is done, so cancelling it is noticed.
+const PollInterval = time.Millisecond * 100
+
 // Deadline is an interface representing something that may provide a deadline.
 // Examples include [context.Context] or [testing.T].
 type Deadline interface {
@@ -23,6 +27,32 @@ func (td TimeDeadline) Deadline() (time.Time, bool) {
 	return time.Time(td), !time.Time(td).IsZero()
 }
 
+// Past is a deadline that has already passed, making queue operations fail instead of blocking.
+var Past = TimeDeadline(time.Unix(0, 1))
+
+// Step limits a blocking call to d or the context's deadline, whichever is sooner.
+func Step(ctx context.Context, d time.Duration) Deadline {
+	t := time.Now().Add(d)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(t) {
+		t = dl
+	}
+	return TimeDeadline(t)
+}
+
+// Sleep waits for d before retrying an operation, waking early if dl passes first.
+// It returns false without waiting if dl has already passed.
+func Sleep(dl Deadline, d time.Duration) bool {
+	if t, ok := dl.Deadline(); ok && !t.IsZero() {
+		until := time.Until(t)
+		if until <= 0 {
+			return false
+		}
+		d = min(d, until)
+	}
+	time.Sleep(d)
+	return true
+}
+
 // ToTimespec converts a Deadline to a [unix.Timespec].
 // If the Deadline has a valid, non-zero deadline, it converts the deadline time to a Timespec.
 // Returns nil if no deadline is set or if the deadline is zero.
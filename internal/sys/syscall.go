@@ -26,18 +26,26 @@ func New(trap uintptr, params int, errnos ...Value) *syscall {
 }
 
 // Call executes the system call and returns an error if one occurs.
+//
+// Pointers converted to uintptr in the call expression are kept on the heap and alive until the call returns.
+//
+//go:uintptrescapes
 func (s *syscall) Call(args ...uintptr) error {
 	_, err := s.CallValue(args...)
 	return err
 }
 
 // CallValue executes the system call and returns a single return value and an error.
+//
+//go:uintptrescapes
 func (s *syscall) CallValue(args ...uintptr) (int, error) {
 	r, _, err := s.CallValues(args...)
 	return r, err
 }
 
 // CallValues executes the system call and returns two return values and an error.
+//
+//go:uintptrescapes
 func (s *syscall) CallValues(args ...uintptr) (int, int, error) {
 	var r1, r2 uintptr
 	var en unix.Errno
@@ -1,6 +1,8 @@
 package posixmq
 
 import (
+	"errors"
+	"fmt"
 	"github.com/bobcatalyst/go-mq/internal/sys"
 	"golang.org/x/sys/unix"
 	"os"
@@ -63,16 +65,57 @@ func RawGetSetAttributes(mqd int, newAttr *Attributes) (attr Attributes, err err
 	return
 }
 
-func DefaultMessageSize() (int, error) { return sizeFromFile("msqsize_default") }
-func MaxMessageSize() (int, error)     { return sizeFromFile("msqsize_max") }
-func DefaultQueueSize() (int, error)   { return sizeFromFile("msq_default") }
-func MaxQueueSize() (int, error)       { return sizeFromFile("msq_max") }
+// mqueueSysctlDir contains the kernel's message queue limits.
+const mqueueSysctlDir = "/proc/sys/fs/mqueue"
+
+type ErrSetLimitNoPermission struct {
+	sys.Err[ErrSetLimitNoPermission]
+}
+
+func (ErrSetLimitNoPermission) Errno() unix.Errno { return unix.EACCES }
+func (ErrSetLimitNoPermission) Error() string {
+	return "the caller does not have permission to change the limit, CAP_SYS_ADMIN or CAP_SYS_RESOURCE is required"
+}
+
+type ErrSetLimitInvalid struct {
+	sys.Err[ErrSetLimitInvalid]
+}
+
+func (ErrSetLimitInvalid) Errno() unix.Errno { return unix.EINVAL }
+func (ErrSetLimitInvalid) Error() string {
+	return "the value is outside the range allowed by the kernel for this limit"
+}
+
+func DefaultMessageSize() (int, error) { return sizeFromFile("msgsize_default") }
+func MaxMessageSize() (int, error)     { return sizeFromFile("msgsize_max") }
+func DefaultQueueSize() (int, error)   { return sizeFromFile("msg_default") }
+func MaxQueueSize() (int, error)       { return sizeFromFile("msg_max") }
 func MaxQueues() (int, error)          { return sizeFromFile("queues_max") }
 
+func SetDefaultMessageSize(size int) error { return sizeToFile("msgsize_default", size) }
+func SetMaxMessageSize(size int) error     { return sizeToFile("msgsize_max", size) }
+func SetDefaultQueueSize(size int) error   { return sizeToFile("msg_default", size) }
+func SetMaxQueueSize(size int) error       { return sizeToFile("msg_max", size) }
+func SetMaxQueues(size int) error          { return sizeToFile("queues_max", size) }
+
 func sizeFromFile(name string) (int, error) {
-	b, err := os.ReadFile(filepath.Join("/proc/sys/fs/mqueue", name))
+	b, err := os.ReadFile(filepath.Join(mqueueSysctlDir, name))
 	if err != nil {
 		return 0, err
 	}
 	return strconv.Atoi(strings.TrimSpace(string(b)))
 }
+
+// sizeToFile writes a limit, mapping permission and range errors to typed errors.
+// Limits are per IPC namespace, so this changes the limit of the caller's namespace.
+func sizeToFile(name string, size int) error {
+	path := filepath.Join(mqueueSysctlDir, name)
+	err := os.WriteFile(path, []byte(strconv.Itoa(size)), 0)
+	switch {
+	case errors.Is(err, unix.EACCES), errors.Is(err, unix.EPERM):
+		return fmt.Errorf("failed to set %s to %d: %w", path, size, ErrSetLimitNoPermission{})
+	case errors.Is(err, unix.EINVAL):
+		return fmt.Errorf("failed to set %s to %d: %w", path, size, ErrSetLimitInvalid{})
+	}
+	return err
+}
@@ -0,0 +1,131 @@
+// Package bridge forwards messages from a local queue over TCP to a peer, which sends them to a queue on its host.
+//
+// A [Sender] receives messages from its queue and numbers them. A [Receiver] sends each message to its queue and
+// then acknowledges it. The sender keeps messages until they are acknowledged and sends them again after
+// reconnecting, and the receiver skips numbers it has already delivered, so no message is lost or duplicated
+// while the peer is down. At most a window of messages is held by the sender, beyond that they wait in the queue.
+// Messages held by a sender that exits before they are acknowledged are lost.
+//
+// The receiver only remembers delivered numbers in memory, for [OptionSessionExpiry] after a sender disconnects.
+// Messages delivered but not yet acknowledged when the receiver restarts, or after it forgets the session,
+// are delivered again when the sender resends them.
+package bridge
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// magic starts every connection, followed by the sender's session ID.
+var magic = [4]byte{'M', 'Q', 'B', '1'}
+
+// maxMessageSize is the largest message a receiver accepts, the kernel's hard limit on message size.
+const maxMessageSize = 16 * 1024 * 1024
+
+// ErrProtocol is returned when the peer sends something that is not part of the bridge protocol.
+type ErrProtocol struct {
+	Reason string
+}
+
+func (err ErrProtocol) Error() string {
+	return "bridge protocol error: " + err.Reason
+}
+
+// Option represents options that can be applied when creating a [Sender] or [Receiver].
+type Option interface {
+	applyOption(*config)
+}
+
+type config struct {
+	tls        *tls.Config
+	window     int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	expiry     time.Duration
+	onError    func(error)
+}
+
+func newConfig(opts []Option) config {
+	c := config{window: 64, minBackoff: time.Millisecond * 100, maxBackoff: time.Second * 10, expiry: time.Minute * 10}
+	for _, opt := range opts {
+		opt.applyOption(&c)
+	}
+	return c
+}
+
+func (c config) reportError(err error) {
+	if c.onError != nil {
+		c.onError(err)
+	}
+}
+
+type (
+	optionTLS     struct{ config *tls.Config }
+	optionWindow  int
+	optionBackoff struct{ min, max time.Duration }
+	optionExpiry  time.Duration
+	optionOnError func(error)
+)
+
+// OptionTLS secures the connection. A sender dials with the config as a client,
+// a receiver uses it to serve TLS on the listener it is given.
+func OptionTLS(config *tls.Config) Option { return optionTLS{config: config} }
+
+// OptionWindow sets how many unacknowledged messages a sender holds, default 64.
+func OptionWindow(n int) Option { return optionWindow(n) }
+
+// OptionBackoff sets the delays between a sender's reconnect attempts, doubling from min to max.
+// The default is 100ms to 10s.
+func OptionBackoff(min, max time.Duration) Option { return optionBackoff{min: min, max: max} }
+
+// OptionSessionExpiry sets how long a receiver remembers a sender session after its last connection ends,
+// default 10 minutes. A sender reconnecting later may have messages delivered twice.
+func OptionSessionExpiry(d time.Duration) Option { return optionExpiry(d) }
+
+// OptionOnError sets a function called with errors that are retried, such as failed connections.
+func OptionOnError(fn func(error)) Option { return optionOnError(fn) }
+
+func (opt optionTLS) applyOption(c *config)     { c.tls = opt.config }
+func (opt optionWindow) applyOption(c *config)  { c.window = max(1, int(opt)) }
+func (opt optionBackoff) applyOption(c *config) { c.minBackoff, c.maxBackoff = opt.min, opt.max }
+func (opt optionExpiry) applyOption(c *config)  { c.expiry = time.Duration(opt) }
+func (opt optionOnError) applyOption(c *config) { c.onError = opt }
+
+// message is a numbered message held by a sender until it is acknowledged.
+type message struct {
+	seq      uint64
+	priority uint32
+	data     []byte
+}
+
+// writeMessage writes a message frame: sequence number, priority, length and data.
+func writeMessage(w *bufio.Writer, m message) error {
+	var hdr [16]byte
+	binary.BigEndian.PutUint64(hdr[0:], m.seq)
+	binary.BigEndian.PutUint32(hdr[8:], m.priority)
+	binary.BigEndian.PutUint32(hdr[12:], uint32(len(m.data)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(m.data)
+	return err
+}
+
+func readMessage(r *bufio.Reader) (message, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return message{}, err
+	}
+	m := message{seq: binary.BigEndian.Uint64(hdr[0:]), priority: binary.BigEndian.Uint32(hdr[8:])}
+	size := binary.BigEndian.Uint32(hdr[12:])
+	if size > maxMessageSize {
+		return message{}, ErrProtocol{Reason: fmt.Sprintf("message of %d bytes is too large", size)}
+	}
+	m.data = make([]byte, size)
+	_, err := io.ReadFull(r, m.data)
+	return m, err
+}
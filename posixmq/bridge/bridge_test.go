@@ -0,0 +1,218 @@
+package bridge
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"github.com/bobcatalyst/go-mq/posixmq"
+	"math/big"
+	mrand "math/rand/v2"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestQueue(t *testing.T) *posixmq.MQ {
+	t.Helper()
+	mq, err := posixmq.New(fmt.Sprintf("/bridge-%d.tmp", mrand.Uint64()),
+		posixmq.OptionCreateArgs(0600, 64, 10),
+		posixmq.OptionOflag(posixmq.OpenReadWrite),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mq.Unlink() })
+	return mq
+}
+
+func serve(t *testing.T, ctx context.Context, r *Receiver, addr string) (net.Addr, <-chan error) {
+	t.Helper()
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- r.Serve(ctx, l) }()
+	return l.Addr(), errc
+}
+
+func expectMessages(t *testing.T, mq *posixmq.MQ, n int) {
+	t.Helper()
+	for i := range n {
+		data, priority, err := mq.Receive(deadline.TimeDeadline(time.Now().Add(time.Second * 5)))
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		} else if string(data) != fmt.Sprint(priority) {
+			t.Fatalf("message %d: expected priority to match data %q, got %d", i, data, priority)
+		}
+	}
+}
+
+func TestBridge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	src, dst := newTestQueue(t), newTestQueue(t)
+
+	addr, rerrc := serve(t, ctx, NewReceiver(dst), "127.0.0.1:0")
+	s := NewSender(src, addr.String(), OptionWindow(4))
+	serrc := make(chan error, 1)
+	go func() { serrc <- s.Run(ctx) }()
+
+	for i := range 20 {
+		priority := uint(i % 5)
+		if err := src.Send(t, []byte(fmt.Sprint(priority)), priority); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectMessages(t, dst, 20)
+
+	cancel()
+	<-serrc
+	<-rerrc
+}
+
+func TestBridge_Reconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	src, dst := newTestQueue(t), newTestQueue(t)
+
+	// Reserve an address for the receiver, which starts after the sender.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	s := NewSender(src, addr, OptionWindow(2), OptionBackoff(time.Millisecond*10, time.Millisecond*50))
+	serrc := make(chan error, 1)
+	go func() { serrc <- s.Run(ctx) }()
+
+	for i := range 5 {
+		if err := src.Send(t, []byte(fmt.Sprint(i)), uint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Messages beyond the window stay in the queue while the peer is down.
+	time.Sleep(time.Millisecond * 50)
+	if n := s.Pending(); n != 2 {
+		t.Fatalf("expected 2 pending messages, got %d", n)
+	}
+
+	rctx, rcancel := context.WithCancel(ctx)
+	_, rerrc := serve(t, rctx, NewReceiver(dst), addr)
+	expectMessages(t, dst, 5)
+
+	// Restart the receiver, messages sent meanwhile are delivered after reconnecting.
+	rcancel()
+	<-rerrc
+	for i := range 3 {
+		if err := src.Send(t, []byte(fmt.Sprint(i)), uint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, rerrc = serve(t, ctx, NewReceiver(dst), addr)
+	expectMessages(t, dst, 3)
+
+	cancel()
+	<-serrc
+	<-rerrc
+}
+
+func TestReceiver_Sessions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dst := newTestQueue(t)
+	r := NewReceiver(dst, OptionSessionExpiry(time.Millisecond*10))
+
+	// Fill the queue so the first session blocks waiting for room.
+	for i := range 10 {
+		if err := dst.Send(t, []byte{byte(i)}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	blocked, other := r.acquire(1), r.acquire(2)
+	errc := make(chan error, 1)
+	go func() { errc <- r.deliver(ctx, blocked, message{seq: 1}) }()
+
+	// A duplicate on the other session is skipped without waiting for the blocked one.
+	other.delivered = 5
+	done := make(chan error, 1)
+	go func() { done <- r.deliver(ctx, other, message{seq: 3}) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("duplicate delivery waited for another session")
+	}
+	cancel()
+	<-errc
+
+	// Idle sessions are forgotten after the expiry, sessions in use are kept.
+	r.release(other)
+	time.Sleep(time.Millisecond * 20)
+	r.acquire(3)
+	r.mu.Lock()
+	_, kept := r.sessions[1]
+	_, expired := r.sessions[2]
+	r.mu.Unlock()
+	if !kept || expired {
+		t.Fatalf("expected only the idle session to expire, got %v", r.sessions)
+	}
+}
+
+func TestBridge_TLS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	src, dst := newTestQueue(t), newTestQueue(t)
+
+	server := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	addr, rerrc := serve(t, ctx, NewReceiver(dst, OptionTLS(server)), "127.0.0.1:0")
+	client := &tls.Config{RootCAs: pool, ServerName: "localhost"}
+	serrc := make(chan error, 1)
+	go func() { serrc <- NewSender(src, addr.String(), OptionTLS(client)).Run(ctx) }()
+
+	if err := src.Send(t, []byte("7"), 7); err != nil {
+		t.Fatal(err)
+	}
+	expectMessages(t, dst, 1)
+
+	cancel()
+	<-serrc
+	<-rerrc
+}
@@ -0,0 +1,153 @@
+package bridge
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"github.com/bobcatalyst/go-mq/posixmq"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Receiver accepts connections from [Sender] bridges and sends their messages to a local queue.
+type Receiver struct {
+	mq *posixmq.MQ
+	c  config
+
+	mu       sync.Mutex
+	sessions map[uint64]*session // By sender session ID.
+}
+
+// session is what a receiver remembers of a sender session.
+type session struct {
+	mu        sync.Mutex // Serializes deliveries, so a reconnecting sender's messages are not delivered twice.
+	delivered uint64     // Last sequence number delivered.
+
+	conns int       // Connections using the session, guarded by Receiver.mu.
+	idle  time.Time // When the last connection ended, guarded by Receiver.mu.
+}
+
+// NewReceiver creates a receiver sending messages to mq.
+func NewReceiver(mq *posixmq.MQ, opts ...Option) *Receiver {
+	return &Receiver{mq: mq, c: newConfig(opts), sessions: map[uint64]*session{}}
+}
+
+// Serve accepts connections on l until ctx is done, closing l when it returns.
+func (r *Receiver) Serve(ctx context.Context, l net.Listener) error {
+	if r.c.tls != nil {
+		l = tls.NewListener(l, r.c.tls)
+	}
+	defer context.AfterFunc(ctx, func() { l.Close() })()
+	defer l.Close()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := l.Accept()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		} else if err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.handle(ctx, conn); err != nil && ctx.Err() == nil {
+				r.c.reportError(fmt.Errorf("connection from %s failed: %w", conn.RemoteAddr(), err))
+			}
+		}()
+	}
+}
+
+// handle delivers messages from one connection, acknowledging each once it is in the queue.
+func (r *Receiver) handle(ctx context.Context, conn net.Conn) error {
+	defer context.AfterFunc(ctx, func() { conn.Close() })()
+	defer conn.Close()
+
+	br, bw := bufio.NewReader(conn), bufio.NewWriter(conn)
+	var hello [12]byte
+	if _, err := io.ReadFull(br, hello[:]); err != nil {
+		return err
+	} else if [4]byte(hello[:4]) != magic {
+		return ErrProtocol{Reason: "connection is not from a bridge"}
+	}
+	s := r.acquire(binary.BigEndian.Uint64(hello[4:]))
+	defer r.release(s)
+
+	for {
+		m, err := readMessage(br)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		} else if err := r.deliver(ctx, s, m); err != nil {
+			return err
+		}
+
+		var ack [8]byte
+		binary.BigEndian.PutUint64(ack[:], m.seq)
+		if _, err := bw.Write(ack[:]); err != nil {
+			return err
+		} else if br.Buffered() > 0 {
+			// More messages are ready, acknowledge them together.
+			continue
+		} else if err := bw.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// acquire returns the session for a new connection, forgetting sessions that have been idle past the expiry.
+func (r *Receiver) acquire(id uint64) *session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for id, s := range r.sessions {
+		if s.conns == 0 && now.Sub(s.idle) > r.c.expiry {
+			delete(r.sessions, id)
+		}
+	}
+
+	s, ok := r.sessions[id]
+	if !ok {
+		s = &session{}
+		r.sessions[id] = s
+	}
+	s.conns++
+	return s
+}
+
+// release marks the end of a connection using the session.
+func (r *Receiver) release(s *session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s.conns--
+	s.idle = time.Now()
+}
+
+// deliver sends the message to the queue unless it was already delivered.
+// Only the session is locked, so a session waiting for room in the queue does not hold up the others.
+func (r *Receiver) deliver(ctx context.Context, s *session, m message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m.seq <= s.delivered {
+		return nil
+	}
+	for {
+		err := r.mq.Send(deadline.Step(ctx, deadline.PollInterval), m.data, uint(m.priority))
+		if err == nil {
+			s.delivered = m.seq
+			return nil
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		} else if !errors.Is(err, posixmq.ErrSendRecvTimeout{}) {
+			return fmt.Errorf("failed to send to queue: %w", err)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package bridge
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"github.com/bobcatalyst/go-mq/posixmq"
+	"io"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+)
+
+// Sender forwards messages from a local queue to a [Receiver].
+type Sender struct {
+	mq      *posixmq.MQ
+	addr    string
+	c       config
+	session uint64
+
+	slots chan struct{} // Holds a value for each message in pending, bounding it to the window.
+	added chan struct{} // Signalled when a message is added to pending.
+
+	mu      sync.Mutex
+	pending []message // Messages not yet acknowledged, in sequence order.
+	next    uint64    // Sequence number of the next message.
+}
+
+// NewSender creates a sender forwarding messages from mq to the receiver at addr.
+func NewSender(mq *posixmq.MQ, addr string, opts ...Option) *Sender {
+	c := newConfig(opts)
+	return &Sender{
+		mq:      mq,
+		addr:    addr,
+		c:       c,
+		session: rand.Uint64(),
+		slots:   make(chan struct{}, c.window),
+		added:   make(chan struct{}, 1),
+		next:    1,
+	}
+}
+
+// Pending returns the number of messages received from the queue that the receiver has not acknowledged.
+func (s *Sender) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+// Run forwards messages until ctx is done or receiving from the queue fails,
+// reconnecting to the receiver whenever the connection is lost.
+func (s *Sender) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		cancel(s.receive(ctx))
+	}()
+	defer wg.Wait()
+
+	backoff := s.c.minBackoff
+	for {
+		connected, err := s.connect(ctx)
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		} else if connected {
+			backoff = s.c.minBackoff
+		}
+		s.c.reportError(fmt.Errorf("connection to %s failed: %w", s.addr, err))
+
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, s.c.maxBackoff)
+	}
+}
+
+// receive moves messages from the queue to pending while the window has room.
+func (s *Sender) receive(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case s.slots <- struct{}{}:
+		}
+
+		var msg posixmq.Message
+		for {
+			var err error
+			if msg, err = s.mq.ReceiveMessage(deadline.Step(ctx, deadline.PollInterval)); err == nil || errors.Is(err, posixmq.ErrExpiryMissing{}) {
+				break
+			} else if ctx.Err() != nil {
+				return nil
+			} else if !errors.Is(err, posixmq.ErrSendRecvTimeout{}) {
+				return fmt.Errorf("failed to receive from queue: %w", err)
+			}
+		}
+
+		s.mu.Lock()
+		// Messages are forwarded as stored, so the receiving queue gets the expiry too.
+		s.pending = append(s.pending, message{seq: s.next, priority: uint32(msg.Priority), data: bytes.Clone(msg.Raw())})
+		s.next++
+		s.mu.Unlock()
+		select {
+		case s.added <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// ack removes messages up to seq from pending.
+func (s *Sender) ack(seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for n < len(s.pending) && s.pending[n].seq <= seq {
+		n++
+	}
+	s.pending = s.pending[n:]
+	for range n {
+		<-s.slots
+	}
+}
+
+// connect sends pending messages over one connection until it fails, reporting whether it was established.
+func (s *Sender) connect(ctx context.Context) (bool, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return false, err
+	}
+	if s.c.tls != nil {
+		tconn := tls.Client(conn, s.c.tls)
+		if err := tconn.HandshakeContext(ctx); err != nil {
+			return false, errors.Join(err, conn.Close())
+		}
+		conn = tconn
+	}
+	defer context.AfterFunc(ctx, func() { conn.Close() })()
+	defer conn.Close()
+
+	w := bufio.NewWriter(conn)
+	var hello [12]byte
+	copy(hello[:], magic[:])
+	binary.BigEndian.PutUint64(hello[4:], s.session)
+	if _, err := w.Write(hello[:]); err != nil {
+		return false, err
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- s.readAcks(conn) }()
+	defer func() {
+		conn.Close()
+		<-errc
+	}()
+
+	// Everything pending is sent again, the receiver skips what it already delivered.
+	var sent uint64
+	for {
+		s.mu.Lock()
+		batch := make([]message, 0, len(s.pending))
+		for _, m := range s.pending {
+			if m.seq > sent {
+				batch = append(batch, m)
+			}
+		}
+		s.mu.Unlock()
+
+		for _, m := range batch {
+			if err := writeMessage(w, m); err != nil {
+				return true, err
+			}
+			sent = m.seq
+		}
+		if err := w.Flush(); err != nil {
+			return true, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+		case err := <-errc:
+			errc <- err
+			return true, err
+		case <-s.added:
+		}
+	}
+}
+
+// readAcks reads acknowledged sequence numbers until the connection fails.
+func (s *Sender) readAcks(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	var buf [8]byte
+	for {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		s.ack(binary.BigEndian.Uint64(buf[:]))
+	}
+}
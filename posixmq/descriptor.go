@@ -0,0 +1,173 @@
+package posixmq
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"net"
+	"os"
+	"strings"
+)
+
+// ErrUnlinkNoName is returned when unlinking a queue whose name is unknown,
+// such as one created by [FromMqd] or [FromFile].
+type ErrUnlinkNoName struct{}
+
+func (ErrUnlinkNoName) Error() string {
+	return "the queue was created from a descriptor and its name is unknown"
+}
+
+// FromMqd creates an [MQ] from an existing message queue descriptor, such as one inherited from a parent process.
+// The descriptor is validated with mq_getattr and owned by the returned MQ, it is closed by [MQ.Close].
+// Options that only apply when opening a queue by name are ignored.
+func FromMqd(mqd int, opts ...MQOption) (*MQ, error) {
+	return fromMqd(mqd, "", opts)
+}
+
+// FromFile creates an [MQ] from a duplicate of the message queue descriptor held by f.
+// f remains owned by the caller.
+func FromFile(f *os.File, opts ...MQOption) (*MQ, error) {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var mqd int
+	var dupErr error
+	if err := rc.Control(func(fd uintptr) {
+		mqd, dupErr = unix.FcntlInt(fd, unix.F_DUPFD_CLOEXEC, 0)
+	}); err != nil {
+		return nil, err
+	} else if dupErr != nil {
+		return nil, fmt.Errorf("failed to duplicate descriptor: %w", dupErr)
+	}
+
+	mq, err := fromMqd(mqd, "", opts)
+	if err != nil {
+		return nil, errors.Join(err, unix.Close(mqd))
+	}
+	return mq, nil
+}
+
+// fromMqd validates mqd and creates an MQ from it, name may be empty if unknown.
+func fromMqd(mqd int, name string, opts []MQOption) (mq *MQ, err error) {
+	if _, err := RawGetSetAttributes(mqd, nil); err != nil {
+		return nil, fmt.Errorf("%d is not a message queue descriptor: %w", mqd, err)
+	}
+
+	mq = &MQ{mqd: mqd, name: name}
+	if name != "" {
+		if mq.bname, err = namePtrFromString(name); err != nil {
+			return nil, err
+		}
+	}
+	for _, opt := range opts {
+		opt.applyOption(mq)
+	}
+	mq.attr, mq.mode, mq.ns = nil, 0, nil
+
+	flags, err := unix.FcntlInt(uintptr(mqd), unix.F_GETFL, 0)
+	if err != nil {
+		return nil, err
+	}
+	fdFlags, err := unix.FcntlInt(uintptr(mqd), unix.F_GETFD, 0)
+	if err != nil {
+		return nil, err
+	}
+	mq.oflag = OpenFlag(flags) & (unix.O_ACCMODE | OpenNonBlocking)
+	if fdFlags&unix.FD_CLOEXEC != 0 {
+		mq.oflag |= OpenCloseOnExec
+	}
+
+	mq.setup()
+	return mq, nil
+}
+
+// File returns a duplicate of the queue's descriptor as an [os.File], which can be passed to a child process
+// using [os/exec.Cmd.ExtraFiles]. The file must be closed separately from the queue.
+func (mq *MQ) File() (*os.File, error) {
+	fd, err := unix.FcntlInt(uintptr(mq.mqd), unix.F_DUPFD_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to duplicate descriptor: %w", err)
+	}
+	return os.NewFile(uintptr(fd), mq.name), nil
+}
+
+// SetCloseOnExec sets or clears [OpenCloseOnExec] on the queue's descriptor.
+// Clearing it lets the descriptor be inherited with the same number across exec.
+func (mq *MQ) SetCloseOnExec(closeOnExec bool) error {
+	var flag int
+	if closeOnExec {
+		flag = unix.FD_CLOEXEC
+	}
+	if _, err := unix.FcntlInt(uintptr(mq.mqd), unix.F_SETFD, flag); err != nil {
+		return err
+	}
+
+	if closeOnExec {
+		mq.oflag |= OpenCloseOnExec
+	} else {
+		mq.oflag &^= OpenCloseOnExec
+	}
+	return nil
+}
+
+// SendMQ passes the descriptors of mqs over a Unix socket using SCM_RIGHTS, along with their names.
+// The queues remain open in the sender.
+func SendMQ(conn *net.UnixConn, mqs ...*MQ) error {
+	fds := make([]int, len(mqs))
+	names := make([]string, len(mqs))
+	for i, mq := range mqs {
+		fds[i] = mq.mqd
+		names[i] = mq.name
+	}
+
+	// At least one byte of data must be sent along with the descriptors, so the names are always terminated.
+	data := []byte(strings.Join(names, "\x00") + "\x00")
+	_, _, err := conn.WriteMsgUnix(data, unix.UnixRights(fds...), nil)
+	return err
+}
+
+// ReceiveMQ receives up to n queues sent with [SendMQ].
+func ReceiveMQ(conn *net.UnixConn, n int, opts ...MQOption) ([]*MQ, error) {
+	data := make([]byte, n*(unix.NAME_MAX+1))
+	oob := make([]byte, unix.CmsgSpace(n*4))
+	dn, oobn, _, _, err := conn.ReadMsgUnix(data, oob)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, err
+	}
+	var fds []int
+	for _, msg := range msgs {
+		rights, err := unix.ParseUnixRights(&msg)
+		if err != nil {
+			return nil, err
+		}
+		fds = append(fds, rights...)
+	}
+	names := strings.Split(strings.TrimSuffix(string(data[:dn]), "\x00"), "\x00")
+
+	mqs := make([]*MQ, 0, len(fds))
+	for i, fd := range fds {
+		var name string
+		if i < len(names) {
+			name = names[i]
+		}
+		mq, err := fromMqd(fd, name, opts)
+		if err != nil {
+			for _, fd := range fds[i:] {
+				err = errors.Join(err, unix.Close(fd))
+			}
+			for _, mq := range mqs {
+				err = errors.Join(err, mq.Close())
+			}
+			return nil, err
+		}
+		mqs = append(mqs, mq)
+	}
+	return mqs, nil
+}
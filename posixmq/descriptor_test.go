@@ -0,0 +1,93 @@
+package posixmq
+
+import (
+	"errors"
+	"golang.org/x/sys/unix"
+	"net"
+	"os"
+	"testing"
+)
+
+func TestFromMqd(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if _, err := FromFile(r); !errors.Is(err, ErrBadFileDescriptor{}) {
+		t.Fatalf("expected ErrBadFileDescriptor for a pipe, got %v", err)
+	}
+
+	mq, err := New(randName(), OptionCreateArgs(0644, 1, 1), OptionOflag(OpenReadWrite|OpenNonBlocking))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mq.Unlink()
+
+	f, err := mq.File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	fmq, err := FromFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fmq.Close()
+	if expected := OpenReadWrite | OpenNonBlocking | OpenCloseOnExec; fmq.Oflag() != expected {
+		t.Fatalf("expected oflag %s, got %s", expected, fmq.Oflag())
+	}
+	if err := fmq.Unlink(); !errors.Is(err, ErrUnlinkNoName{}) {
+		t.Fatalf("expected ErrUnlinkNoName, got %v", err)
+	}
+}
+
+func TestSendMQ(t *testing.T) {
+	name := randName()
+	mq, err := New(name, OptionCreateArgs(0644, 1, 1), OptionOflag(OpenReadWrite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mq.Unlink()
+
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := make([]*net.UnixConn, 2)
+	for i, fd := range fds {
+		f := os.NewFile(uintptr(fd), "socketpair")
+		c, err := net.FileConn(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		conns[i] = c.(*net.UnixConn)
+	}
+
+	if err := SendMQ(conns[0], mq); err != nil {
+		t.Fatal(err)
+	}
+	mqs, err := ReceiveMQ(conns[1], 1)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(mqs) != 1 {
+		t.Fatalf("expected 1 queue, got %d", len(mqs))
+	}
+	defer mqs[0].Close()
+	if mqs[0].Name() != name {
+		t.Fatalf("expected name %q, got %q", name, mqs[0].Name())
+	}
+
+	if err := mq.Send(t, []byte{1}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if data, _, err := mqs[0].Receive(t); err != nil {
+		t.Fatal(err)
+	} else if len(data) != 1 || data[0] != 1 {
+		t.Fatalf("unexpected message %v", data)
+	}
+}
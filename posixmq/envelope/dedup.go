@@ -0,0 +1,185 @@
+package envelope
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"github.com/bobcatalyst/go-mq/posixmq"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DedupOption represents options that can be applied when creating a [Dedup].
+type DedupOption interface {
+	applyDedupOption(*Dedup)
+}
+
+type (
+	dedupWindow  time.Duration
+	dedupSize    int
+	dedupPersist string
+)
+
+// DedupWindow sets how long an ID is remembered after it is first seen, default 10 minutes. It must be positive.
+func DedupWindow(d time.Duration) DedupOption { return dedupWindow(d) }
+
+// DedupSize sets how many IDs are remembered, the oldest are forgotten first, default 100000. It must be positive.
+func DedupSize(n int) DedupOption { return dedupSize(n) }
+
+// DedupPersist stores the remembered IDs in the file at path when [Dedup.Save] is called,
+// and loads them when the filter is created, so duplicates are still dropped after a restart.
+// IDs seen after the last save are forgotten if the process exits, so save periodically and before exiting.
+func DedupPersist(path string) DedupOption { return dedupPersist(path) }
+
+func (opt dedupWindow) applyDedupOption(d *Dedup)  { d.window = time.Duration(opt) }
+func (opt dedupSize) applyDedupOption(d *Dedup)    { d.size = int(opt) }
+func (opt dedupPersist) applyDedupOption(d *Dedup) { d.path = string(opt) }
+
+// Dedup is an idempotent consumer filter, dropping envelopes whose ID it has already seen.
+// IDs are remembered for a bounded window and number, so a repeat arriving later than that is not caught.
+// Envelopes without an ID are never dropped. A Dedup is safe for concurrent use.
+type Dedup struct {
+	window time.Duration
+	size   int
+	path   string
+
+	mu      sync.Mutex
+	seen    map[ID]time.Time
+	order   []seenID // IDs in the order they were first seen, oldest first.
+	dropped uint64
+}
+
+type seenID struct {
+	ID   ID        `json:"id"`
+	Seen time.Time `json:"seen"`
+}
+
+// NewDedup creates a filter, loading the IDs persisted by [DedupPersist] if the file exists.
+func NewDedup(opts ...DedupOption) (*Dedup, error) {
+	d := &Dedup{window: time.Minute * 10, size: 100000, seen: map[ID]time.Time{}}
+	for _, opt := range opts {
+		opt.applyDedupOption(d)
+	}
+	if d.window <= 0 {
+		return nil, fmt.Errorf("invalid dedup window %s, it must be positive", d.window)
+	} else if d.size <= 0 {
+		return nil, fmt.Errorf("invalid dedup size %d, it must be positive", d.size)
+	}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Seen remembers id, reporting whether it was already seen within the window.
+func (d *Dedup) Seen(id ID) bool {
+	if id.IsZero() {
+		return false
+	}
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expire(now)
+	if _, ok := d.seen[id]; ok {
+		d.dropped++
+		return true
+	}
+	d.add(seenID{ID: id, Seen: now})
+	return false
+}
+
+// Dropped returns how many repeats [Dedup.Seen] has reported.
+func (d *Dedup) Dropped() uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dropped
+}
+
+// Receive receives envelopes from mq until one that has not been seen arrives.
+// The payload is only valid until the next receive from mq.
+// A message that is not an envelope is returned in [ErrInvalidMessage], it has been taken off the queue.
+func (d *Dedup) Receive(dl deadline.Deadline, mq *posixmq.MQ) (Envelope, uint, error) {
+	for {
+		e, priority, err := Receive(dl, mq)
+		if err != nil || !d.Seen(e.ID) {
+			return e, priority, err
+		}
+	}
+}
+
+// add remembers an ID, forgetting the oldest if the size is exceeded. Must be called with mu held.
+func (d *Dedup) add(s seenID) {
+	d.seen[s.ID] = s.Seen
+	d.order = append(d.order, s)
+	for len(d.order) > d.size {
+		d.forgetOldest()
+	}
+}
+
+// expire forgets IDs first seen before the window. Must be called with mu held.
+func (d *Dedup) expire(now time.Time) {
+	for len(d.order) > 0 && now.Sub(d.order[0].Seen) >= d.window {
+		d.forgetOldest()
+	}
+}
+
+func (d *Dedup) forgetOldest() {
+	delete(d.seen, d.order[0].ID)
+	d.order[0] = seenID{}
+	d.order = d.order[1:]
+}
+
+// Save writes the remembered IDs to the file set by [DedupPersist], if one is set.
+// The file is replaced atomically so a crash never leaves a partial file behind.
+func (d *Dedup) Save() error {
+	if d.path == "" {
+		return nil
+	}
+	d.mu.Lock()
+	d.expire(time.Now())
+	b, err := json.Marshal(d.order)
+	d.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(d.path), filepath.Base(d.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		return errors.Join(err, tmp.Close())
+	} else if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), d.path)
+}
+
+// load reads the IDs saved to the persistence file, if one is set and exists.
+func (d *Dedup) load() error {
+	if d.path == "" {
+		return nil
+	}
+	b, err := os.ReadFile(d.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var order []seenID
+	if err := json.Unmarshal(b, &order); err != nil {
+		return fmt.Errorf("failed to load seen IDs from %q: %w", d.path, err)
+	}
+	for _, s := range order {
+		if _, ok := d.seen[s.ID]; !ok {
+			d.add(s)
+		}
+	}
+	d.expire(time.Now())
+	return nil
+}
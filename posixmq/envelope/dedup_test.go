@@ -0,0 +1,147 @@
+package envelope
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"github.com/bobcatalyst/go-mq/posixmq"
+	"math/rand/v2"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewOrderedID(t *testing.T) {
+	start := time.Now().Truncate(time.Millisecond)
+	prev := NewOrderedID()
+	for range 10000 {
+		id := NewOrderedID()
+		if id.Compare(prev) <= 0 {
+			t.Fatalf("expected %s to sort after %s", id, prev)
+		}
+		prev = id
+	}
+	if ts := prev.Time(); ts.Before(start) || ts.After(time.Now()) {
+		t.Fatalf("unexpected ID time %s", ts)
+	}
+
+	var parsed ID
+	if text, err := prev.MarshalText(); err != nil {
+		t.Fatal(err)
+	} else if err := parsed.UnmarshalText(text); err != nil {
+		t.Fatal(err)
+	} else if parsed != prev {
+		t.Fatalf("expected %s, got %s", prev, parsed)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	d, err := NewDedup(DedupWindow(time.Millisecond*50), DedupSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b, c := NewOrderedID(), NewOrderedID(), NewOrderedID()
+	for i, tt := range []struct {
+		id   ID
+		seen bool
+	}{
+		{a, false}, {a, true}, {ID{}, false}, {ID{}, false}, {b, false}, {a, true},
+		{c, false}, {a, false}, // a is forgotten to make room for c.
+	} {
+		if seen := d.Seen(tt.id); seen != tt.seen {
+			t.Fatalf("%d: expected seen %v for %s", i, tt.seen, tt.id)
+		}
+	}
+	if dropped := d.Dropped(); dropped != 2 {
+		t.Fatalf("expected 2 dropped, got %d", dropped)
+	}
+
+	time.Sleep(time.Millisecond * 60)
+	if d.Seen(c) {
+		t.Fatal("expected c to be forgotten after the window")
+	}
+}
+
+func TestDedup_Persist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seen.json")
+	d, err := NewDedup(DedupPersist(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := NewOrderedID()
+	d.Seen(id)
+	if err := d.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if d, err = NewDedup(DedupPersist(path)); err != nil {
+		t.Fatal(err)
+	} else if !d.Seen(id) {
+		t.Fatal("expected the ID to be remembered after loading")
+	}
+	// Loaded IDs are still subject to the window.
+	if d, err = NewDedup(DedupPersist(path), DedupWindow(time.Nanosecond)); err != nil {
+		t.Fatal(err)
+	} else if d.Seen(id) {
+		t.Fatal("expected the ID to be expired after loading")
+	}
+}
+
+func TestDedup_Receive(t *testing.T) {
+	mq, err := posixmq.New(fmt.Sprintf("/dedup-%d.tmp", rand.Uint64()),
+		posixmq.OptionCreateArgs(0600, 128, 8),
+		posixmq.OptionOflag(posixmq.OpenReadWrite|posixmq.OpenExclusive),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mq.Unlink()
+
+	// A retried send repeats the ID assigned by the first.
+	first := Envelope{Payload: []byte("first")}
+	second := Envelope{Payload: []byte("second")}
+	for _, e := range []*Envelope{&first, &first, &second} {
+		if err := Send(t, mq, e, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if first.ID.IsZero() || first.Time.IsZero() {
+		t.Fatal("expected Send to set the ID and time")
+	}
+
+	d, err := NewDedup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"first", "second"} {
+		if e, _, err := d.Receive(t, mq); err != nil {
+			t.Fatal(err)
+		} else if string(e.Payload) != expected {
+			t.Fatalf("expected %q, got %q", expected, e.Payload)
+		}
+	}
+	if _, _, err := d.Receive(deadline.TimeDeadline(time.Now().Add(time.Millisecond*10)), mq); err == nil {
+		t.Fatal("expected the queue to be empty")
+	} else if d.Dropped() != 1 {
+		t.Fatalf("expected 1 dropped, got %d", d.Dropped())
+	}
+
+	// A message that is not an envelope is handed back with the error.
+	if err := mq.Send(t, []byte("raw"), 2); err != nil {
+		t.Fatal(err)
+	}
+	var invalid ErrInvalidMessage
+	if _, _, err := d.Receive(t, mq); !errors.As(err, &invalid) {
+		t.Fatalf("expected ErrInvalidMessage, got %v", err)
+	} else if string(invalid.Data) != "raw" || invalid.Priority != 2 || !errors.As(err, new(ErrMalformed)) {
+		t.Fatalf("unexpected invalid message %+v", invalid)
+	}
+}
+
+func TestNewDedup_Invalid(t *testing.T) {
+	for _, opt := range []DedupOption{DedupSize(0), DedupSize(-1), DedupWindow(0), DedupWindow(-time.Second)} {
+		if _, err := NewDedup(opt); err == nil {
+			t.Fatalf("expected an error for %#v", opt)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+// Package envelope defines a compact binary envelope for messages, so features carried alongside a payload
+// share one header instead of each prefixing their own bytes.
+//
+// An envelope is encoded big endian as:
+//
+//	[4]byte  magic 0xff 'E' 'N' 'V'
+//	uint8    version
+//	uint16   flags
+//	[16]byte message ID
+//	int64    timestamp in Unix nanoseconds, 0 if not set, so the Unix epoch itself can't be represented
+//	uint8    content type length, content type
+//	uint16   header count, then for each header in increasing key order:
+//	         uint8 key length, key, uint16 value length, value
+//	[]byte   payload, the rest of the message
+//
+// Parsing is strict, anything that would not be encoded the same way again is rejected.
+//
+// [Send] gives each envelope a time-ordered ID, which a [Dedup] uses to drop messages a producer sent twice.
+package envelope
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"github.com/bobcatalyst/go-mq/posixmq"
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Version is the envelope format version written by [Envelope.MarshalBinary].
+const Version = 1
+
+// magic starts every envelope. Like the expiry header, it starts with a byte that is invalid in UTF-8,
+// so text payloads are never mistaken for an envelope.
+var magic = [4]byte{0xff, 'E', 'N', 'V'}
+
+// fixedLen is the size of the fields before the content type.
+const fixedLen = len(magic) + 1 + 2 + len(ID{}) + 8
+
+const (
+	maxContentType = math.MaxUint8
+	maxHeaders     = math.MaxUint16
+	maxKey         = math.MaxUint8
+	maxValue       = math.MaxUint16
+)
+
+// ID identifies a message.
+type ID [16]byte
+
+// NewID returns a random ID.
+func NewID() (id ID) {
+	rand.Read(id[:])
+	return id
+}
+
+// IsZero reports whether the ID is not set.
+func (id ID) IsZero() bool { return id == ID{} }
+
+func (id ID) String() string { return hex.EncodeToString(id[:]) }
+
+// Flags are bits defined by applications, the envelope carries them without interpreting them.
+type Flags uint16
+
+// Envelope is a message with its metadata.
+type Envelope struct {
+	Flags       Flags
+	ID          ID
+	Time        time.Time // When the message was created, zero if not set. The Unix epoch is reserved and reads back as zero.
+	ContentType string    // MIME type of the payload.
+	Headers     map[string]string
+	Payload     []byte
+}
+
+// ErrMalformed is returned when parsing data that is not a valid envelope.
+type ErrMalformed struct {
+	Offset int // Byte offset of the problem.
+	Reason string
+}
+
+func (err ErrMalformed) Error() string {
+	return fmt.Sprintf("malformed envelope at byte %d: %s", err.Offset, err.Reason)
+}
+
+// ErrVersion is returned when parsing an envelope of a version this package does not know.
+type ErrVersion struct {
+	Version byte
+}
+
+func (err ErrVersion) Error() string {
+	return fmt.Sprintf("unsupported envelope version %d, expected %d", err.Version, Version)
+}
+
+// ErrFieldTooLong is returned when marshalling an envelope with a field too long for the format.
+type ErrFieldTooLong struct {
+	Field string
+	Len   int
+	Max   int
+}
+
+func (err ErrFieldTooLong) Error() string {
+	return fmt.Sprintf("envelope %s is %d long, the limit is %d", err.Field, err.Len, err.Max)
+}
+
+// ErrInvalidMessage is returned by [Receive] when a message taken off the queue is not a valid envelope.
+// Data holds the message, which is only valid until the next receive from the queue.
+// Err is the parse error, usually [ErrMalformed] or [ErrVersion].
+type ErrInvalidMessage struct {
+	Data     []byte
+	Priority uint
+	Err      error
+}
+
+func (err ErrInvalidMessage) Error() string {
+	return fmt.Sprintf("received an invalid envelope: %v", err.Err)
+}
+
+func (err ErrInvalidMessage) Unwrap() error { return err.Err }
+
+// IsEnvelope reports whether data starts with the envelope magic.
+func IsEnvelope(data []byte) bool {
+	return bytes.HasPrefix(data, magic[:])
+}
+
+// MarshalBinary encodes the envelope.
+func (e Envelope) MarshalBinary() ([]byte, error) {
+	return e.AppendBinary(nil)
+}
+
+// AppendBinary appends the encoded envelope to b.
+func (e Envelope) AppendBinary(b []byte) ([]byte, error) {
+	if len(e.ContentType) > maxContentType {
+		return nil, ErrFieldTooLong{Field: "content type", Len: len(e.ContentType), Max: maxContentType}
+	} else if len(e.Headers) > maxHeaders {
+		return nil, ErrFieldTooLong{Field: "header count", Len: len(e.Headers), Max: maxHeaders}
+	}
+	keys := make([]string, 0, len(e.Headers))
+	size := fixedLen + 1 + len(e.ContentType) + 2 + len(e.Payload)
+	for key, value := range e.Headers {
+		if err := validKey(key); err != "" {
+			return nil, fmt.Errorf("invalid header key %q: %s", key, err)
+		} else if len(value) > maxValue {
+			return nil, ErrFieldTooLong{Field: "header " + key, Len: len(value), Max: maxValue}
+		}
+		keys = append(keys, key)
+		size += 1 + len(key) + 2 + len(value)
+	}
+	slices.Sort(keys)
+
+	b = slices.Grow(b, size)
+	b = append(b, magic[:]...)
+	b = append(b, Version)
+	b = binary.BigEndian.AppendUint16(b, uint16(e.Flags))
+	b = append(b, e.ID[:]...)
+	var nanos int64
+	if !e.Time.IsZero() {
+		nanos = e.Time.UnixNano()
+	}
+	b = binary.BigEndian.AppendUint64(b, uint64(nanos))
+	b = append(b, byte(len(e.ContentType)))
+	b = append(b, e.ContentType...)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(keys)))
+	for _, key := range keys {
+		b = append(b, byte(len(key)))
+		b = append(b, key...)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(e.Headers[key])))
+		b = append(b, e.Headers[key]...)
+	}
+	return append(b, e.Payload...), nil
+}
+
+// UnmarshalBinary parses an envelope, copying the payload out of data.
+func (e *Envelope) UnmarshalBinary(data []byte) error {
+	env, err := Parse(data)
+	if err != nil {
+		return err
+	}
+	env.Payload = bytes.Clone(env.Payload)
+	*e = env
+	return nil
+}
+
+// Parse parses an envelope. The payload refers to data rather than a copy.
+func Parse(data []byte) (Envelope, error) {
+	p := parser{data: data}
+	if !IsEnvelope(data) {
+		return Envelope{}, ErrMalformed{Offset: 0, Reason: "missing magic"}
+	}
+	p.off = len(magic)
+	if v, err := p.uint8(); err != nil {
+		return Envelope{}, err
+	} else if v != Version {
+		return Envelope{}, ErrVersion{Version: v}
+	}
+
+	var e Envelope
+	flags, err := p.uint16()
+	if err != nil {
+		return Envelope{}, err
+	}
+	e.Flags = Flags(flags)
+	id, err := p.bytes(len(e.ID))
+	if err != nil {
+		return Envelope{}, err
+	}
+	e.ID = ID(id)
+	nanos, err := p.bytes(8)
+	if err != nil {
+		return Envelope{}, err
+	} else if n := int64(binary.BigEndian.Uint64(nanos)); n != 0 {
+		e.Time = time.Unix(0, n)
+	}
+
+	n, err := p.uint8()
+	if err != nil {
+		return Envelope{}, err
+	}
+	contentType, err := p.bytes(int(n))
+	if err != nil {
+		return Envelope{}, err
+	} else if !utf8.Valid(contentType) {
+		return Envelope{}, ErrMalformed{Offset: p.off - len(contentType), Reason: "content type is not valid UTF-8"}
+	}
+	e.ContentType = string(contentType)
+
+	count, err := p.uint16()
+	if err != nil {
+		return Envelope{}, err
+	}
+	if count > 0 {
+		e.Headers = make(map[string]string, count)
+	}
+	var prev string
+	for i := range int(count) {
+		n, err := p.uint8()
+		if err != nil {
+			return Envelope{}, err
+		}
+		off := p.off
+		key, err := p.bytes(int(n))
+		if err != nil {
+			return Envelope{}, err
+		} else if reason := validKey(string(key)); reason != "" {
+			return Envelope{}, ErrMalformed{Offset: off, Reason: "header key " + reason}
+		} else if i > 0 && string(key) <= prev {
+			return Envelope{}, ErrMalformed{Offset: off, Reason: "header keys are not in increasing order"}
+		}
+		prev = string(key)
+
+		vn, err := p.uint16()
+		if err != nil {
+			return Envelope{}, err
+		}
+		value, err := p.bytes(int(vn))
+		if err != nil {
+			return Envelope{}, err
+		}
+		e.Headers[prev] = string(value)
+	}
+
+	e.Payload = data[p.off:]
+	return e, nil
+}
+
+// Headers parses only the headers of an envelope, it can be used as the header parser of a router.
+func Headers(data []byte) (map[string]string, error) {
+	e, err := Parse(data)
+	return e.Headers, err
+}
+
+// validKey returns why a header key is invalid, or "" if it is valid.
+func validKey(key string) string {
+	switch {
+	case key == "":
+		return "is empty"
+	case len(key) > maxKey:
+		return fmt.Sprintf("is longer than %d bytes", maxKey)
+	case !utf8.ValidString(key):
+		return "is not valid UTF-8"
+	case strings.ContainsRune(key, 0):
+		return "contains a NUL byte"
+	}
+	return ""
+}
+
+// parser reads the fields of an envelope, reporting where data ends early.
+type parser struct {
+	data []byte
+	off  int
+}
+
+func (p *parser) bytes(n int) ([]byte, error) {
+	if len(p.data)-p.off < n {
+		return nil, ErrMalformed{Offset: len(p.data), Reason: "truncated"}
+	}
+	b := p.data[p.off : p.off+n]
+	p.off += n
+	return b, nil
+}
+
+func (p *parser) uint8() (byte, error) {
+	b, err := p.bytes(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (p *parser) uint16() (uint16, error) {
+	b, err := p.bytes(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(b), nil
+}
+
+// Send marshals the envelope and sends it to mq. An envelope without an ID is given one from [NewOrderedID],
+// and one without a time is given the current time. Both are set on e, so sending the same envelope again
+// after [posixmq.ErrSendRecvTimeout] or [posixmq.ErrSendRecvInterrupted] repeats its ID,
+// and a [Dedup] can drop the copy if the first send did enqueue it.
+func Send(dl deadline.Deadline, mq *posixmq.MQ, e *Envelope, priority uint, opts ...posixmq.SendOption) error {
+	if e.ID.IsZero() {
+		e.ID = NewOrderedID()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	data, err := e.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return mq.Send(dl, data, priority, opts...)
+}
+
+// Receive receives a message from mq and parses it. The payload is only valid until the next receive from mq.
+// A message that can't be parsed has still been taken off the queue, it is returned in [ErrInvalidMessage].
+func Receive(dl deadline.Deadline, mq *posixmq.MQ) (Envelope, uint, error) {
+	data, priority, err := mq.Receive(dl)
+	if err != nil {
+		return Envelope{}, 0, err
+	}
+	e, err := Parse(data)
+	if err != nil {
+		return Envelope{}, priority, ErrInvalidMessage{Data: data, Priority: priority, Err: err}
+	}
+	return e, priority, nil
+}
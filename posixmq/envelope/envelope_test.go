@@ -0,0 +1,173 @@
+package envelope
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/posixmq"
+	"math/rand/v2"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEnvelope() Envelope {
+	return Envelope{
+		Flags:       0x8001,
+		ID:          NewID(),
+		Time:        time.Unix(1700000000, 123456789),
+		ContentType: "application/json",
+		Headers:     map[string]string{"trace-id": "abc", "tenant": "acme", "empty": ""},
+		Payload:     []byte(`{"a":1}`),
+	}
+}
+
+func equal(a, b Envelope) bool {
+	return a.Flags == b.Flags && a.ID == b.ID && a.Time.Equal(b.Time) && a.ContentType == b.ContentType &&
+		reflect.DeepEqual(a.Headers, b.Headers) && bytes.Equal(a.Payload, b.Payload)
+}
+
+func TestEnvelope_RoundTrip(t *testing.T) {
+	for _, expected := range []Envelope{testEnvelope(), {}, {Payload: []byte("only a payload")}} {
+		data, err := expected.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		} else if !IsEnvelope(data) {
+			t.Fatal("expected marshalled data to be an envelope")
+		}
+
+		var got Envelope
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		} else if !equal(got, expected) {
+			t.Fatalf("expected %+v, got %+v", expected, got)
+		}
+	}
+}
+
+func TestEnvelope_TimeEpoch(t *testing.T) {
+	for _, test := range []struct {
+		time     time.Time
+		expected time.Time
+	}{
+		// The epoch encodes as 0, which is reserved for an unset time.
+		{time: time.Unix(0, 0), expected: time.Time{}},
+		{time: time.Unix(0, 1), expected: time.Unix(0, 1)},
+		{time: time.Unix(0, -1), expected: time.Unix(0, -1)},
+	} {
+		data, err := Envelope{Time: test.time}.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := Parse(data); err != nil {
+			t.Fatal(err)
+		} else if !got.Time.Equal(test.expected) || got.Time.IsZero() != test.expected.IsZero() {
+			t.Fatalf("expected %v to read back as %v, got %v", test.time, test.expected, got.Time)
+		}
+	}
+}
+
+func TestParse_Malformed(t *testing.T) {
+	valid, err := testEnvelope().MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := func(keys ...string) []byte {
+		b := append(magic[:], Version, 0, 0)
+		b = append(b, make([]byte, 16+8)...)
+		b = append(b, 0, 0, byte(len(keys)))
+		for _, k := range keys {
+			b = append(b, byte(len(k)))
+			b = append(b, k...)
+			b = append(b, 0, 0)
+		}
+		return b
+	}
+
+	for name, tt := range map[string]struct {
+		data     []byte
+		expected error
+	}{
+		"empty":     {nil, ErrMalformed{Offset: 0, Reason: "missing magic"}},
+		"text":      {[]byte("hello"), ErrMalformed{Offset: 0, Reason: "missing magic"}},
+		"version":   {append(magic[:], 2), ErrVersion{Version: 2}},
+		"truncated": {valid[:40], ErrMalformed{Offset: 40, Reason: "truncated"}},
+		"empty key": {header(""), ErrMalformed{Offset: 35, Reason: "header key is empty"}},
+		"order":     {header("b", "a"), ErrMalformed{Offset: 39, Reason: "header keys are not in increasing order"}},
+		"duplicate": {header("a", "a"), ErrMalformed{Offset: 39, Reason: "header keys are not in increasing order"}},
+		"utf8":      {header("\xff"), ErrMalformed{Offset: 35, Reason: "header key is not valid UTF-8"}},
+	} {
+		if _, err := Parse(tt.data); !reflect.DeepEqual(err, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", name, tt.expected, err)
+		}
+	}
+
+	// Every cut inside the header is rejected.
+	for n := range len(valid) - len(testEnvelope().Payload) {
+		if _, err := Parse(valid[:n]); err == nil {
+			t.Fatalf("expected data cut at %d to be rejected", n)
+		}
+	}
+}
+
+func TestEnvelope_FieldTooLong(t *testing.T) {
+	_, err := Envelope{ContentType: strings.Repeat("x", 256)}.MarshalBinary()
+	if !errors.As(err, new(ErrFieldTooLong)) {
+		t.Fatalf("expected ErrFieldTooLong, got %v", err)
+	}
+	if _, err := (Envelope{Headers: map[string]string{"": "x"}}).MarshalBinary(); err == nil {
+		t.Fatal("expected an empty header key to be rejected")
+	}
+}
+
+func TestSendReceive(t *testing.T) {
+	mq, err := posixmq.New(fmt.Sprintf("/envelope-%d.tmp", rand.Uint64()),
+		posixmq.OptionCreateArgs(0600, 256, 4),
+		posixmq.OptionOflag(posixmq.OpenReadWrite|posixmq.OpenExclusive),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mq.Unlink()
+
+	expected := testEnvelope()
+	if err := Send(t, mq, &expected, 3); err != nil {
+		t.Fatal(err)
+	}
+	if got, priority, err := Receive(t, mq); err != nil {
+		t.Fatal(err)
+	} else if priority != 3 || !equal(got, expected) {
+		t.Fatalf("expected %+v at priority 3, got %+v at %d", expected, got, priority)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, e := range []Envelope{testEnvelope(), {}, {Headers: map[string]string{"k": "v"}, Payload: []byte{0xff}}} {
+		data, err := e.MarshalBinary()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte("plain text"))
+	f.Add(append(magic[:], Version))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		e, err := Parse(data)
+		if err != nil {
+			var malformed ErrMalformed
+			if errors.As(err, &malformed) && (malformed.Offset < 0 || malformed.Offset > len(data)) {
+				t.Fatalf("offset %d outside of %d bytes", malformed.Offset, len(data))
+			}
+			return
+		}
+		// Anything accepted is in its canonical encoding.
+		again, err := e.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(again, data) {
+			t.Fatalf("parsed %x but marshalled it as %x", data, again)
+		}
+	})
+}
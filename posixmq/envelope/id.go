@@ -0,0 +1,75 @@
+package envelope
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// orderedIDs makes IDs from the same millisecond increase, like a monotonic ULID.
+var orderedIDs struct {
+	sync.Mutex
+	last ID
+}
+
+// NewOrderedID returns an ID that sorts after every ID returned before it by the process, like a ULID.
+// The first 6 bytes are the Unix time in milliseconds and the other 10 are random. Within the same millisecond,
+// the random part of the previous ID is incremented instead, so IDs stay ordered and unique.
+func NewOrderedID() ID {
+	var id ID
+	ms := uint64(time.Now().UnixMilli())
+	binary.BigEndian.PutUint16(id[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(id[2:6], uint32(ms))
+	rand.Read(id[6:])
+
+	orderedIDs.Lock()
+	defer orderedIDs.Unlock()
+	if last := orderedIDs.last; id.Compare(last) <= 0 {
+		// The clock did not move past the last ID, so count up from it.
+		id = last
+		for i := len(id) - 1; i >= 0; i-- {
+			if id[i]++; id[i] != 0 {
+				break
+			}
+		}
+	}
+	orderedIDs.last = id
+	return id
+}
+
+// Time returns when an ID from [NewOrderedID] was created, to the millisecond.
+// It is meaningless for other IDs.
+func (id ID) Time() time.Time {
+	ms := uint64(binary.BigEndian.Uint16(id[0:2]))<<32 | uint64(binary.BigEndian.Uint32(id[2:6]))
+	return time.UnixMilli(int64(ms))
+}
+
+// Compare returns -1, 0 or 1 as id sorts before, the same as, or after other.
+func (id ID) Compare(other ID) int {
+	for i := range id {
+		if id[i] != other[i] {
+			if id[i] < other[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// MarshalText encodes the ID as hex.
+func (id ID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+// UnmarshalText decodes an ID encoded by [ID.MarshalText].
+func (id *ID) UnmarshalText(text []byte) error {
+	if hex.DecodedLen(len(text)) != len(id) {
+		return fmt.Errorf("invalid ID %q, expected %d hex characters", text, hex.EncodedLen(len(id)))
+	}
+	_, err := hex.Decode(id[:], text)
+	return err
+}
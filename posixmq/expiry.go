@@ -0,0 +1,166 @@
+package posixmq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"time"
+)
+
+// expiryMagic prefixes every message sent with an expiry.
+// It starts with a byte that is invalid in UTF-8 so text payloads are never mistaken for a header.
+var expiryMagic = [4]byte{0xff, 'T', 'T', 'L'}
+
+// expiryHeaderLen is the size of the expiry header, the magic followed by the expiry in Unix nanoseconds.
+const expiryHeaderLen = len(expiryMagic) + 8
+
+// ErrExpiryMissing is returned by [MQ.Receive] in strict mode when a message has no expiry header.
+// The message is still returned alongside the error.
+type ErrExpiryMissing struct{}
+
+func (ErrExpiryMissing) Error() string {
+	return "the message does not have an expiry header"
+}
+
+// SendOption represents options that can be applied to a single [MQ.Send].
+type SendOption interface {
+	applySendOption(*sendOptions)
+}
+
+type sendOptions struct {
+	expiresAt time.Time
+}
+
+type (
+	sendTTL       time.Duration
+	sendExpiresAt time.Time
+)
+
+// SendTTL sets the message to expire once d has elapsed.
+// Receivers only discard expired messages if they open the queue with [OptionExpiry].
+func SendTTL(d time.Duration) SendOption { return sendTTL(d) }
+
+// SendExpiresAt sets the message to expire at t.
+func SendExpiresAt(t time.Time) SendOption { return sendExpiresAt(t) }
+
+func (opt sendTTL) applySendOption(so *sendOptions) {
+	so.expiresAt = time.Now().Add(time.Duration(opt))
+}
+func (opt sendExpiresAt) applySendOption(so *sendOptions) { so.expiresAt = time.Time(opt) }
+
+// encodeSendOptions applies the send options and prepends any required header to data.
+func encodeSendOptions(data []byte, opts []SendOption) []byte {
+	if len(opts) == 0 {
+		return data
+	}
+
+	var so sendOptions
+	for _, opt := range opts {
+		opt.applySendOption(&so)
+	}
+	if so.expiresAt.IsZero() {
+		return data
+	}
+
+	buf := make([]byte, 0, expiryHeaderLen+len(data))
+	buf = append(buf, expiryMagic[:]...)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(so.expiresAt.UnixNano()))
+	return append(buf, data...)
+}
+
+// decodeExpiry splits a message into its expiry and payload.
+// ok is false if the message has no expiry header, in which case data is returned unchanged.
+func decodeExpiry(data []byte) (expiresAt time.Time, payload []byte, ok bool) {
+	if len(data) < expiryHeaderLen || !bytes.Equal(data[:len(expiryMagic)], expiryMagic[:]) {
+		return time.Time{}, data, false
+	}
+	nanos := int64(binary.BigEndian.Uint64(data[len(expiryMagic):expiryHeaderLen]))
+	return time.Unix(0, nanos), data[expiryHeaderLen:], true
+}
+
+// ExpiredFunc is called with the payload of each expired message discarded by [MQ.Receive].
+// The payload is only valid for the duration of the call.
+type ExpiredFunc func(data []byte, priority uint, expiredAt time.Time)
+
+// ExpireTo returns an [ExpiredFunc] that forwards expired messages to an expiry queue.
+// Messages are forwarded with their original priority and without an expiry header.
+// Forwarding is best effort, a message is dropped if it cannot be sent before dl.
+func ExpireTo(mq *MQ, dl deadline.Deadline) ExpiredFunc {
+	return func(data []byte, priority uint, _ time.Time) {
+		_ = mq.Send(dl, data, priority)
+	}
+}
+
+type optionExpiry struct {
+	strict    bool
+	onExpired ExpiredFunc
+}
+
+// OptionExpiry makes [MQ.Receive] handle messages sent with [SendTTL] or [SendExpiresAt].
+// Without it, messages are received exactly as they were sent, including any expiry header.
+// Expired messages are discarded, onExpired is called for each one if it is not nil.
+// If strict is set, messages without an expiry header are returned with [ErrExpiryMissing].
+func OptionExpiry(strict bool, onExpired ExpiredFunc) MQOption {
+	return &optionExpiry{strict: strict, onExpired: onExpired}
+}
+
+func (opt *optionExpiry) applyOption(mq *MQ) { mq.expiry = opt }
+
+// Message is a message received with [MQ.ReceiveMessage].
+type Message struct {
+	Data     []byte
+	Priority uint
+	// ExpiresAt is when the message expires, zero if it was sent without an expiry.
+	// It is only decoded if the queue was opened with [OptionExpiry], otherwise any expiry header is part of Data,
+	// so forwarding Data keeps the expiry either way.
+	ExpiresAt time.Time
+}
+
+// Raw returns the message as it is stored in the queue, with an expiry header if it has an expiry.
+func (msg Message) Raw() []byte {
+	if msg.ExpiresAt.IsZero() {
+		return msg.Data
+	}
+	return encodeSendOptions(msg.Data, []SendOption{SendExpiresAt(msg.ExpiresAt)})
+}
+
+// EncodeMessage returns the bytes [MQ.Send] puts in the queue for data sent with opts.
+// Sending the result without options is the same as sending data with opts, so a message can be stored
+// and sent later with its expiry intact.
+func EncodeMessage(data []byte, opts ...SendOption) []byte {
+	return encodeSendOptions(data, opts)
+}
+
+// receiveInto receives a message into buf, discarding any expired messages.
+func (mq *MQ) receiveInto(dl deadline.Deadline, buf []byte) (data []byte, priority uint, _ error) {
+	msg, err := mq.receiveMessageInto(dl, buf)
+	return msg.Data, msg.Priority, err
+}
+
+// receiveMessageInto receives a message into buf. Expiry headers are only decoded with OptionExpiry,
+// so payloads that happen to start like a header are left alone on other queues.
+func (mq *MQ) receiveMessageInto(dl deadline.Deadline, buf []byte) (Message, error) {
+	for {
+		var priority uint
+		size, err := RawSendReceive(mq.mqd, dl, buf, &priority)
+		if err != nil {
+			return Message{}, err
+		} else if mq.expiry == nil {
+			return Message{Data: buf[:size], Priority: priority}, nil
+		}
+
+		expiresAt, payload, ok := decodeExpiry(buf[:size])
+		if !ok {
+			if mq.expiry.strict {
+				return Message{Data: payload, Priority: priority}, ErrExpiryMissing{}
+			}
+			return Message{Data: payload, Priority: priority}, nil
+		} else if time.Now().Before(expiresAt) {
+			return Message{Data: payload, Priority: priority, ExpiresAt: expiresAt}, nil
+		}
+
+		if mq.expiry.onExpired != nil {
+			mq.expiry.onExpired(payload, priority, expiresAt)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package posixmq
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMQ_ReceiveExpired(t *testing.T) {
+	var expired [][]byte
+	mq, err := New(randName(),
+		OptionCreateArgs(0644, 32, 4),
+		OptionOflag(OpenReadWrite),
+		OptionExpiry(false, func(data []byte, _ uint, _ time.Time) {
+			expired = append(expired, append([]byte(nil), data...))
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mq.Unlink()
+
+	if err := mq.Send(t, []byte("stale"), 2, SendTTL(time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if err := mq.Send(t, []byte("fresh"), 1, SendTTL(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := mq.Send(t, []byte("plain"), 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 5)
+
+	for _, expected := range []string{"fresh", "plain"} {
+		data, _, err := mq.Receive(t)
+		if err != nil {
+			t.Fatal(err)
+		} else if string(data) != expected {
+			t.Fatalf("expected %q, got %q", expected, data)
+		}
+	}
+	if len(expired) != 1 || string(expired[0]) != "stale" {
+		t.Fatalf("expected the stale message to expire, got %q", expired)
+	}
+}
+
+func TestMQ_ReceiveExpiryStrict(t *testing.T) {
+	mq, err := New(randName(),
+		OptionCreateArgs(0644, 32, 4),
+		OptionOflag(OpenReadWrite),
+		OptionExpiry(true, nil),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mq.Unlink()
+
+	if err := mq.Send(t, []byte("plain"), 0); err != nil {
+		t.Fatal(err)
+	}
+	data, _, err := mq.Receive(t)
+	if !errors.Is(err, ErrExpiryMissing{}) {
+		t.Fatalf("expected ErrExpiryMissing, got %v", err)
+	} else if string(data) != "plain" {
+		t.Fatalf("expected %q, got %q", "plain", data)
+	}
+}
+
+func TestMQ_ReceiveWithoutExpiry(t *testing.T) {
+	mq, err := New(randName(), OptionCreateArgs(0644, 32, 4), OptionOflag(OpenReadWrite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mq.Unlink()
+
+	// Without OptionExpiry, a payload that looks like an expired header is returned untouched.
+	expected := EncodeMessage([]byte("binary"), SendExpiresAt(time.Unix(1, 0)))
+	if err := mq.Send(t, expected, 0); err != nil {
+		t.Fatal(err)
+	}
+	if data, _, err := mq.Receive(t); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(data, expected) {
+		t.Fatalf("expected %q, got %q", expected, data)
+	}
+}
+
+func TestMQ_ForwardMessage(t *testing.T) {
+	var queues []*MQ
+	for range 2 {
+		mq, err := New(randName(), OptionCreateArgs(0644, 32, 4), OptionOflag(OpenReadWrite), OptionExpiry(false, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mq.Unlink()
+		queues = append(queues, mq)
+	}
+
+	expiresAt := time.Now().Add(time.Hour).Round(0)
+	if err := queues[0].Send(t, []byte("ttl"), 3, SendExpiresAt(expiresAt)); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := queues[0].ReceiveMessage(t)
+	if err != nil {
+		t.Fatal(err)
+	} else if !msg.ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("expected expiry %s, got %s", expiresAt, msg.ExpiresAt)
+	} else if err := queues[1].SendMessage(t, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg, err := queues[1].ReceiveMessage(t); err != nil {
+		t.Fatal(err)
+	} else if string(msg.Data) != "ttl" || msg.Priority != 3 || !msg.ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("expiry was not forwarded, got %+v", msg)
+	}
+}
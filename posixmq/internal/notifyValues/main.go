@@ -14,7 +14,7 @@ import "C"
 
 func main() {
 	var b []byte
-	for _, i := range []int{C.SIGEV_NONE, C.SIGEV_SIGNAL} {
+	for _, i := range []int{C.SIGEV_NONE, C.SIGEV_SIGNAL, C.SIGEV_THREAD} {
 		b = binary.AppendVarint(b, int64(i))
 	}
 
@@ -0,0 +1,134 @@
+package posixmq
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/internal/sys"
+	"golang.org/x/sys/unix"
+	"os"
+	"unsafe"
+)
+
+const (
+	// mqPrioMax is the number of message priorities supported by the kernel.
+	mqPrioMax = 32768
+	// hardMsgMax is the largest MaxQueueSize the kernel allows, even with CAP_SYS_RESOURCE.
+	hardMsgMax = 65536
+	// hardMsgSizeMax is the largest MaxMessageSize the kernel allows, even with CAP_SYS_RESOURCE.
+	hardMsgSizeMax = 16 * 1024 * 1024
+	// msgOverhead is the size of the kernel's struct msg_msg and struct posix_msg_tree_node, six words each.
+	msgOverhead = 6 * unsafe.Sizeof(uintptr(0))
+)
+
+// MaxPriority is the highest priority a message can be sent with.
+const MaxPriority = mqPrioMax - 1
+
+type ErrSetRlimitNoPermission struct {
+	sys.Err[ErrSetRlimitNoPermission]
+}
+
+func (ErrSetRlimitNoPermission) Errno() unix.Errno { return unix.EPERM }
+func (ErrSetRlimitNoPermission) Error() string {
+	return "raising the hard limit requires CAP_SYS_RESOURCE"
+}
+
+// MessageQueueRlimit returns the current and maximum RLIMIT_MSGQUEUE, the number of bytes
+// that can be allocated for message queues by all processes of the real user.
+func MessageQueueRlimit() (cur, max uint64, err error) {
+	var rl unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_MSGQUEUE, &rl); err != nil {
+		return 0, 0, err
+	}
+	return rl.Cur, rl.Max, nil
+}
+
+// RaiseMessageQueueRlimit raises the current RLIMIT_MSGQUEUE to at least size bytes.
+// The hard limit is only raised if required, which needs CAP_SYS_RESOURCE.
+// The limit is never lowered.
+func RaiseMessageQueueRlimit(size uint64) error {
+	var rl unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_MSGQUEUE, &rl); err != nil {
+		return err
+	} else if rl.Cur >= size {
+		return nil
+	}
+
+	rl.Cur = size
+	rl.Max = max(rl.Max, size)
+	if err := unix.Setrlimit(unix.RLIMIT_MSGQUEUE, &rl); errors.Is(err, unix.EPERM) {
+		return fmt.Errorf("failed to raise RLIMIT_MSGQUEUE to %d: %w", size, ErrSetRlimitNoPermission{})
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CreateCost returns the number of bytes the kernel counts against RLIMIT_MSGQUEUE for a queue with attr.
+// This mirrors the calculation in the kernel's mqueue_get_inode.
+func CreateCost(attr Attributes) uint64 {
+	maxMsg := uint64(max(attr.MaxQueueSize, 0))
+	msgSize := uint64(max(attr.MaxMessageSize, 0))
+	treeSize := maxMsg*uint64(msgOverhead) + min(maxMsg, mqPrioMax)*uint64(msgOverhead)
+	return treeSize + maxMsg*msgSize
+}
+
+// CheckCreate reports in advance whether creating a queue with attr would fail.
+// It returns nil if the queue should be creatable, otherwise an error explaining why,
+// wrapping [ErrOpenInvalid], [ErrOpenProcessLimitReached], or [ErrNoMemory].
+//
+// The RLIMIT_MSGQUEUE usage of other queues belonging to the user cannot be read from userspace,
+// so the check assumes none of the limit is in use and can only detect a queue too large on its own.
+func CheckCreate(attr Attributes) error {
+	if attr.MaxQueueSize <= 0 || attr.MaxMessageSize <= 0 {
+		return fmt.Errorf("%w: MaxQueueSize(%d) and MaxMessageSize(%d) must be positive", ErrOpenInvalid{}, attr.MaxQueueSize, attr.MaxMessageSize)
+	} else if attr.MaxQueueSize > hardMsgMax || attr.MaxMessageSize > hardMsgSizeMax {
+		return fmt.Errorf("%w: MaxQueueSize(%d) and MaxMessageSize(%d) must not exceed the kernel hard limits of %d and %d", ErrOpenInvalid{}, attr.MaxQueueSize, attr.MaxMessageSize, hardMsgMax, hardMsgSizeMax)
+	}
+
+	if privileged, err := hasCapability(unix.CAP_SYS_RESOURCE); err != nil {
+		return err
+	} else if !privileged {
+		if maxQueue, err := MaxQueueSize(); err != nil {
+			return err
+		} else if attr.MaxQueueSize > maxQueue {
+			return fmt.Errorf("%w: MaxQueueSize(%d) exceeds %s/msg_max(%d) and the caller lacks CAP_SYS_RESOURCE", ErrOpenInvalid{}, attr.MaxQueueSize, mqueueSysctlDir, maxQueue)
+		}
+		if maxMsg, err := MaxMessageSize(); err != nil {
+			return err
+		} else if attr.MaxMessageSize > maxMsg {
+			return fmt.Errorf("%w: MaxMessageSize(%d) exceeds %s/msgsize_max(%d) and the caller lacks CAP_SYS_RESOURCE", ErrOpenInvalid{}, attr.MaxMessageSize, mqueueSysctlDir, maxMsg)
+		}
+	}
+
+	cost := CreateCost(attr)
+	if cur, _, err := MessageQueueRlimit(); err != nil {
+		return err
+	} else if cur != unix.RLIM_INFINITY && cost > cur {
+		return fmt.Errorf("%w: the queue needs %d bytes but RLIMIT_MSGQUEUE is %d bytes, see RaiseMessageQueueRlimit", ErrOpenProcessLimitReached{}, cost, cur)
+	}
+
+	var nofile unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &nofile); err != nil {
+		return err
+	} else if fds, err := os.ReadDir("/proc/self/fd"); err == nil && uint64(len(fds)) >= nofile.Cur {
+		return fmt.Errorf("%w: %d descriptors are open and RLIMIT_NOFILE is %d", ErrOpenProcessLimitReached{}, len(fds), nofile.Cur)
+	}
+
+	var info unix.Sysinfo_t
+	if err := unix.Sysinfo(&info); err != nil {
+		return err
+	} else if free := uint64(info.Freeram) * uint64(info.Unit); cost > free {
+		return fmt.Errorf("%w: the queue needs %d bytes but only %d bytes of memory are free", ErrNoMemory{}, cost, free)
+	}
+	return nil
+}
+
+// hasCapability reports whether the calling thread has the effective capability.
+func hasCapability(capability int) (bool, error) {
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&hdr, &data[0]); err != nil {
+		return false, err
+	}
+	return data[capability/32].Effective&(1<<(capability%32)) != 0, nil
+}
@@ -0,0 +1,61 @@
+package posixmq
+
+import (
+	"errors"
+	"golang.org/x/sys/unix"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	for name, fn := range map[string]func() (int, error){
+		"DefaultMessageSize": DefaultMessageSize,
+		"MaxMessageSize":     MaxMessageSize,
+		"DefaultQueueSize":   DefaultQueueSize,
+		"MaxQueueSize":       MaxQueueSize,
+		"MaxQueues":          MaxQueues,
+	} {
+		if v, err := fn(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		} else if v <= 0 {
+			t.Fatalf("%s: expected a positive value, got %d", name, v)
+		} else {
+			t.Logf("%s(%d)", name, v)
+		}
+	}
+}
+
+func TestCheckCreate(t *testing.T) {
+	if err := CheckCreate(Attributes{MaxQueueSize: 1, MaxMessageSize: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckCreate(Attributes{MaxQueueSize: 0, MaxMessageSize: 1}); !errors.Is(err, ErrOpenInvalid{}) {
+		t.Fatalf("expected ErrOpenInvalid, got %v", err)
+	} else if !errors.Is(err, unix.EINVAL) {
+		t.Fatalf("expected EINVAL, got %v", err)
+	}
+
+	cur, _, err := MessageQueueRlimit()
+	if err != nil {
+		t.Fatal(err)
+	} else if cur == unix.RLIM_INFINITY {
+		t.Skip("RLIMIT_MSGQUEUE is unlimited")
+	}
+
+	// Find a queue that is within the kernel limits but more than the rlimit on its own.
+	attr := Attributes{MaxQueueSize: 1, MaxMessageSize: hardMsgSizeMax}
+	for CreateCost(attr) <= cur && attr.MaxQueueSize < hardMsgMax {
+		attr.MaxQueueSize *= 2
+	}
+	if CreateCost(attr) <= cur {
+		t.Skipf("RLIMIT_MSGQUEUE of %d is too large to exceed", cur)
+	}
+
+	err = CheckCreate(attr)
+	t.Log(err)
+	if privileged, _ := hasCapability(unix.CAP_SYS_RESOURCE); privileged && !errors.Is(err, ErrOpenProcessLimitReached{}) {
+		t.Fatalf("expected ErrOpenProcessLimitReached, got %v", err)
+	} else if err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,177 @@
+package posixmq
+
+import (
+	"errors"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+)
+
+// MirrorDirection selects which traffic of a [Mirror] is copied.
+type MirrorDirection int
+
+const (
+	MirrorSend    MirrorDirection = 1 << iota // Messages sent through the mirror.
+	MirrorReceive                             // Messages received through the mirror.
+)
+
+// MirroredMessage is a copy of a message passing through a [Mirror].
+// Data is only valid for the duration of [MirrorSink.Mirror].
+type MirroredMessage struct {
+	Time      time.Time
+	Queue     string
+	Direction MirrorDirection
+	Priority  uint
+	Data      []byte
+	ExpiresAt time.Time // Zero if the message has no expiry, see [Message].
+}
+
+// MirrorSink receives copies of messages from a [Mirror]. It is called synchronously on the primary path,
+// so a slow sink slows the primary path down. Sinks should return [ErrSendFullQueue] instead of waiting for room.
+type MirrorSink interface {
+	Mirror(MirroredMessage) error
+}
+
+// MirrorFunc is a function used as a [MirrorSink].
+type MirrorFunc func(MirroredMessage) error
+
+func (fn MirrorFunc) Mirror(m MirroredMessage) error { return fn(m) }
+
+type mirrorQueue struct{ mq *MQ }
+
+// MirrorToQueue copies messages to a shadow queue opened for writing, with their original priority and expiry.
+// Messages are dropped while the shadow queue is full.
+func MirrorToQueue(mq *MQ) MirrorSink { return mirrorQueue{mq: mq} }
+
+func (s mirrorQueue) Mirror(m MirroredMessage) error {
+	err := s.mq.SendMessage(deadline.Past, Message{Data: m.Data, Priority: m.Priority, ExpiresAt: m.ExpiresAt})
+	if errors.Is(err, ErrSendRecvTimeout{}) {
+		return ErrSendFullQueue{}
+	}
+	return err
+}
+
+// MirrorStats counts the messages seen by a [Mirror].
+type MirrorStats struct {
+	Mirrored uint64 // Copied to the sink.
+	Skipped  uint64 // Not sampled.
+	Dropped  uint64 // The sink was full.
+	Failed   uint64 // The sink returned another error.
+}
+
+// MirrorOption represents options that can be applied when creating a [Mirror].
+type MirrorOption interface {
+	applyMirrorOption(*Mirror)
+}
+
+type (
+	mirrorSample     float64
+	mirrorDirections MirrorDirection
+	mirrorOnError    func(error)
+)
+
+// MirrorSample sets the fraction of messages copied, chosen at random, default 1 for every message.
+func MirrorSample(rate float64) MirrorOption { return mirrorSample(rate) }
+
+// MirrorDirections sets which traffic is copied, default MirrorSend|MirrorReceive.
+func MirrorDirections(dir MirrorDirection) MirrorOption { return mirrorDirections(dir) }
+
+// MirrorOnError sets a function called when the sink fails with an error other than [ErrSendFullQueue].
+func MirrorOnError(fn func(error)) MirrorOption { return mirrorOnError(fn) }
+
+func (opt mirrorSample) applyMirrorOption(m *Mirror)     { m.sample = float64(opt) }
+func (opt mirrorDirections) applyMirrorOption(m *Mirror) { m.dir = MirrorDirection(opt) }
+func (opt mirrorOnError) applyMirrorOption(m *Mirror)    { m.onError = opt }
+
+// Mirror wraps a queue, copying the messages sent and received through it to a sink on a best effort basis.
+// Sink failures are counted, never returned, so the primary path is unaffected by sink errors,
+// but each send and receive waits for the sink to take its copy.
+type Mirror struct {
+	mq      *MQ
+	sink    MirrorSink
+	sample  float64
+	dir     MirrorDirection
+	onError func(error)
+
+	mirrored, skipped, dropped, failed atomic.Uint64
+}
+
+// NewMirror creates a mirror of mq copying to sink.
+func NewMirror(mq *MQ, sink MirrorSink, opts ...MirrorOption) *Mirror {
+	m := &Mirror{mq: mq, sink: sink, sample: 1, dir: MirrorSend | MirrorReceive}
+	for _, opt := range opts {
+		opt.applyMirrorOption(m)
+	}
+	return m
+}
+
+// MQ returns the mirrored queue.
+func (m *Mirror) MQ() *MQ {
+	return m.mq
+}
+
+// Send sends a message to the queue, copying it once it has been sent.
+func (m *Mirror) Send(dl deadline.Deadline, data []byte, priority uint, opts ...SendOption) error {
+	raw := encodeSendOptions(data, opts)
+	if err := m.mq.Send(dl, raw, priority); err != nil {
+		return err
+	}
+	msg := Message{Data: data, Priority: priority}
+	// A header was only added if the options set an expiry.
+	if expiresAt, _, ok := decodeExpiry(raw); ok && len(raw) > len(data) {
+		msg.ExpiresAt = expiresAt
+	}
+	m.copy(MirrorSend, msg)
+	return nil
+}
+
+// Receive retrieves a message from the queue, copying it before it is returned.
+// Like [MQ.Receive], the returned data is invalid after the next call, and a message without an expiry
+// is returned along with [ErrExpiryMissing] by a strict [OptionExpiry], which is copied as well.
+func (m *Mirror) Receive(dl deadline.Deadline) (data []byte, priority uint, _ error) {
+	msg, err := m.mq.ReceiveMessage(dl)
+	if err == nil || errors.Is(err, ErrExpiryMissing{}) {
+		m.copy(MirrorReceive, msg)
+	}
+	return msg.Data, msg.Priority, err
+}
+
+// Stats returns the counts of messages seen so far.
+func (m *Mirror) Stats() MirrorStats {
+	return MirrorStats{
+		Mirrored: m.mirrored.Load(),
+		Skipped:  m.skipped.Load(),
+		Dropped:  m.dropped.Load(),
+		Failed:   m.failed.Load(),
+	}
+}
+
+func (m *Mirror) copy(dir MirrorDirection, msg Message) {
+	if m.dir&dir == 0 {
+		return
+	} else if m.sample < 1 && rand.Float64() >= m.sample {
+		m.skipped.Add(1)
+		return
+	}
+
+	err := m.sink.Mirror(MirroredMessage{
+		Time:      time.Now(),
+		Queue:     m.mq.Name(),
+		Direction: dir,
+		Priority:  msg.Priority,
+		Data:      msg.Data,
+		ExpiresAt: msg.ExpiresAt,
+	})
+	switch {
+	case err == nil:
+		m.mirrored.Add(1)
+	case errors.Is(err, ErrSendFullQueue{}):
+		m.dropped.Add(1)
+	default:
+		m.failed.Add(1)
+		if m.onError != nil {
+			m.onError(err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package posixmq
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMirror(t *testing.T) {
+	// The shadow queue holds 4 messages, the rest are dropped.
+	queues := newTestMuxQueues(t, 2)
+	primary, shadow := queues[0], queues[1]
+	m := NewMirror(primary, MirrorToQueue(shadow), MirrorDirections(MirrorSend))
+
+	for i := range 4 {
+		if err := m.Send(t, []byte{byte(i)}, uint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range 4 {
+		if _, _, err := m.Receive(t); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range 2 {
+		if err := m.Send(t, []byte{byte(i)}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := m.Stats(); stats != (MirrorStats{Mirrored: 4, Dropped: 2}) {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	for i := 3; i >= 0; i-- {
+		data, priority, err := shadow.Receive(t)
+		if err != nil {
+			t.Fatal(err)
+		} else if data[0] != byte(i) || priority != uint(i) {
+			t.Fatalf("expected message %d, got %d at priority %d", i, data[0], priority)
+		}
+	}
+}
+
+func TestMirror_Func(t *testing.T) {
+	mq := newTestMuxQueues(t, 1)[0]
+	failure := errors.New("sink failed")
+	var seen []MirroredMessage
+	var reported []error
+	m := NewMirror(mq, MirrorFunc(func(msg MirroredMessage) error {
+		seen = append(seen, msg)
+		if len(seen) == 2 {
+			return failure
+		}
+		return nil
+	}), MirrorOnError(func(err error) { reported = append(reported, err) }))
+
+	if err := m.Send(t, []byte{1}, 2); err != nil {
+		t.Fatal(err)
+	} else if _, _, err := m.Receive(t); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 2 || seen[0].Direction != MirrorSend || seen[1].Direction != MirrorReceive ||
+		seen[1].Priority != 2 || seen[1].Queue != mq.Name() {
+		t.Fatalf("unexpected mirrored messages %+v", seen)
+	} else if len(reported) != 1 || reported[0] != failure {
+		t.Fatalf("expected the sink error to be reported, got %v", reported)
+	} else if stats := m.Stats(); stats != (MirrorStats{Mirrored: 1, Failed: 1}) {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// Nothing is copied at a sample rate of 0.
+	m = NewMirror(mq, MirrorFunc(func(MirroredMessage) error { return nil }), MirrorSample(0))
+	if err := m.Send(t, []byte{1}, 0); err != nil {
+		t.Fatal(err)
+	} else if stats := m.Stats(); stats != (MirrorStats{Skipped: 1}) {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestMirror_Expiry(t *testing.T) {
+	var queues []*MQ
+	for range 2 {
+		mq, err := New(randName(), OptionCreateArgs(0644, 32, 4), OptionOflag(OpenReadWrite), OptionExpiry(false, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mq.Unlink()
+		queues = append(queues, mq)
+	}
+	primary, shadow := queues[0], queues[1]
+
+	expiresAt := time.Now().Add(time.Hour).Round(0)
+	m := NewMirror(primary, MirrorToQueue(shadow))
+	if err := m.Send(t, []byte{1}, 0, SendExpiresAt(expiresAt)); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := shadow.ReceiveMessage(t); err != nil {
+		t.Fatal(err)
+	} else if !msg.ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("expected the shadow copy to expire at %s, got %s", expiresAt, msg.ExpiresAt)
+	}
+}
+
+func TestMirror_ExpiryMissing(t *testing.T) {
+	mq, err := New(randName(), OptionCreateArgs(0644, 32, 4), OptionOflag(OpenReadWrite), OptionExpiry(true, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mq.Unlink()
+
+	var seen []MirroredMessage
+	m := NewMirror(mq, MirrorFunc(func(msg MirroredMessage) error {
+		seen = append(seen, msg)
+		return nil
+	}), MirrorDirections(MirrorReceive))
+	if err := mq.Send(t, []byte("plain"), 4); err != nil {
+		t.Fatal(err)
+	}
+
+	// The message is returned with the error instead of being lost, and is mirrored.
+	data, priority, err := m.Receive(t)
+	if !errors.Is(err, ErrExpiryMissing{}) {
+		t.Fatalf("expected ErrExpiryMissing, got %v", err)
+	} else if string(data) != "plain" || priority != 4 {
+		t.Fatalf("expected %q at priority 4, got %q at priority %d", "plain", data, priority)
+	} else if len(seen) != 1 || string(seen[0].Data) != "plain" {
+		t.Fatalf("expected the message to be mirrored, got %+v", seen)
+	}
+}
@@ -0,0 +1,185 @@
+package posixmq
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Watermarks configures the thresholds of a [Monitor].
+// High and Low are fractions of the queue's MaxQueueSize between 0 and 1, e.g. 0.8 and 0.2, Low must not exceed High.
+type Watermarks struct {
+	// High is the depth at or above which the queue is considered backlogged.
+	High float64
+	// Low is the depth at or below which a backlogged queue is considered drained.
+	// Keeping Low below High adds hysteresis so callbacks don't flap around a single threshold.
+	Low float64
+	// FullFor is how long a queue must stay full before it is reported. Zero disables full reporting.
+	FullFor time.Duration
+}
+
+// DepthEvent describes a queue crossing a watermark.
+type DepthEvent struct {
+	MQ         *MQ
+	Attributes Attributes
+	// Since is when the queue entered its current state.
+	Since time.Time
+}
+
+// MonitorOption represents options that can be applied when creating a [Monitor].
+type MonitorOption interface {
+	applyMonitorOption(*Monitor)
+}
+
+type (
+	monitorOnHigh  func(DepthEvent)
+	monitorOnLow   func(DepthEvent)
+	monitorOnFull  func(DepthEvent)
+	monitorOnError func(*MQ, error)
+)
+
+// MonitorOnHigh sets a function called when a queue reaches the high watermark.
+func MonitorOnHigh(fn func(DepthEvent)) MonitorOption { return monitorOnHigh(fn) }
+
+// MonitorOnLow sets a function called when a queue that reached the high watermark drops to the low watermark.
+func MonitorOnLow(fn func(DepthEvent)) MonitorOption { return monitorOnLow(fn) }
+
+// MonitorOnFull sets a function called when a queue has been full for [Watermarks.FullFor].
+func MonitorOnFull(fn func(DepthEvent)) MonitorOption { return monitorOnFull(fn) }
+
+// MonitorOnError sets a function called when the attributes of a queue could not be read.
+func MonitorOnError(fn func(*MQ, error)) MonitorOption { return monitorOnError(fn) }
+
+func (opt monitorOnHigh) applyMonitorOption(m *Monitor)  { m.onHigh = opt }
+func (opt monitorOnLow) applyMonitorOption(m *Monitor)   { m.onLow = opt }
+func (opt monitorOnFull) applyMonitorOption(m *Monitor)  { m.onFull = opt }
+func (opt monitorOnError) applyMonitorOption(m *Monitor) { m.onError = opt }
+
+// Monitor polls the depth of a set of queues and reports when they cross watermarks.
+type Monitor struct {
+	interval time.Duration
+	marks    Watermarks
+	onHigh   func(DepthEvent)
+	onLow    func(DepthEvent)
+	onFull   func(DepthEvent)
+	onError  func(*MQ, error)
+
+	mu     sync.Mutex
+	queues map[*MQ]*depthState
+}
+
+// depthState tracks the watermark state of a single queue.
+type depthState struct {
+	high      bool      // The high watermark was reached and the low one not yet.
+	fullSince time.Time // When the queue became full, zero if it isn't.
+	reported  bool      // The current full period was already reported.
+}
+
+// NewMonitor creates a monitor that checks queues every interval.
+// The interval must be positive and the low watermark below the high one.
+func NewMonitor(interval time.Duration, marks Watermarks, opts ...MonitorOption) (*Monitor, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid monitor interval %s, it must be positive", interval)
+	} else if math.IsNaN(marks.Low) || math.IsNaN(marks.High) ||
+		marks.Low < 0 || marks.High > 1 || marks.Low > marks.High {
+		return nil, fmt.Errorf("invalid watermarks, low (%g) and high (%g) must satisfy 0 <= low <= high <= 1", marks.Low, marks.High)
+	}
+
+	m := &Monitor{
+		interval: interval,
+		marks:    marks,
+		queues:   map[*MQ]*depthState{},
+	}
+	for _, opt := range opts {
+		opt.applyMonitorOption(m)
+	}
+	return m, nil
+}
+
+// Add starts monitoring mq.
+func (m *Monitor) Add(mq *MQ) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.queues[mq]; !ok {
+		m.queues[mq] = &depthState{}
+	}
+}
+
+// Remove stops monitoring mq.
+func (m *Monitor) Remove(mq *MQ) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.queues, mq)
+}
+
+// Run polls the queues until ctx is done.
+func (m *Monitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		m.Poll()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll checks every queue once and calls the callbacks for any watermarks crossed.
+// Callbacks are called after the monitor is unlocked, so they may add or remove queues.
+func (m *Monitor) Poll() {
+	var calls []func()
+	m.mu.Lock()
+	for mq, st := range m.queues {
+		attr, err := mq.GetAttr()
+		if err != nil {
+			if m.onError != nil {
+				calls = append(calls, func() { m.onError(mq, err) })
+			}
+			continue
+		}
+		calls = append(calls, m.check(mq, st, attr, time.Now())...)
+	}
+	m.mu.Unlock()
+
+	for _, call := range calls {
+		call()
+	}
+}
+
+// check updates the state of a queue and returns the callbacks to call.
+func (m *Monitor) check(mq *MQ, st *depthState, attr Attributes, now time.Time) (calls []func()) {
+	depth := float64(attr.NumCurrMessages)
+	size := float64(attr.MaxQueueSize)
+
+	if !st.high && depth >= m.marks.High*size {
+		st.high = true
+		if m.onHigh != nil {
+			ev := DepthEvent{MQ: mq, Attributes: attr, Since: now}
+			calls = append(calls, func() { m.onHigh(ev) })
+		}
+	} else if st.high && depth <= m.marks.Low*size {
+		st.high = false
+		if m.onLow != nil {
+			ev := DepthEvent{MQ: mq, Attributes: attr, Since: now}
+			calls = append(calls, func() { m.onLow(ev) })
+		}
+	}
+
+	if attr.NumCurrMessages < attr.MaxQueueSize {
+		st.fullSince, st.reported = time.Time{}, false
+	} else if st.fullSince.IsZero() {
+		st.fullSince = now
+	}
+	if m.marks.FullFor > 0 && !st.reported && !st.fullSince.IsZero() && now.Sub(st.fullSince) >= m.marks.FullFor {
+		st.reported = true
+		if m.onFull != nil {
+			ev := DepthEvent{MQ: mq, Attributes: attr, Since: st.fullSince}
+			calls = append(calls, func() { m.onFull(ev) })
+		}
+	}
+	return calls
+}
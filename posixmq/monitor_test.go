@@ -0,0 +1,92 @@
+package posixmq
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMonitor_Poll(t *testing.T) {
+	mq, err := New(randName(), OptionCreateArgs(0644, 1, 4), OptionOflag(OpenReadWrite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mq.Unlink()
+
+	var high, low, full int
+	m, err := NewMonitor(time.Second, Watermarks{High: 0.75, Low: 0.25, FullFor: time.Millisecond},
+		MonitorOnHigh(func(DepthEvent) { high++ }),
+		MonitorOnLow(func(DepthEvent) { low++ }),
+		MonitorOnFull(func(DepthEvent) { full++ }),
+		MonitorOnError(func(_ *MQ, err error) { t.Fatal(err) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Add(mq)
+
+	assertCounts := func(eHigh, eLow, eFull int) {
+		t.Helper()
+		m.Poll()
+		if high != eHigh || low != eLow || full != eFull {
+			t.Fatalf("expected high(%d) low(%d) full(%d), got high(%d) low(%d) full(%d)", eHigh, eLow, eFull, high, low, full)
+		}
+	}
+	send := func(n int) {
+		t.Helper()
+		for range n {
+			if err := mq.Send(t, []byte{1}, 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	receive := func(n int) {
+		t.Helper()
+		for range n {
+			if _, _, err := mq.Receive(t); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	assertCounts(0, 0, 0)
+	send(3)
+	assertCounts(1, 0, 0)
+	send(1)
+	assertCounts(1, 0, 0)
+	time.Sleep(time.Millisecond * 2)
+	assertCounts(1, 0, 1)
+	receive(2)
+	assertCounts(1, 0, 1)
+	receive(1)
+	assertCounts(1, 1, 1)
+	send(3)
+	assertCounts(2, 1, 1)
+}
+
+func TestNewMonitor_Invalid(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		interval time.Duration
+		marks    Watermarks
+	}{
+		{name: "zero interval", interval: 0, marks: Watermarks{High: 0.8, Low: 0.2}},
+		{name: "negative interval", interval: -time.Second, marks: Watermarks{High: 0.8, Low: 0.2}},
+		{name: "inverted watermarks", interval: time.Second, marks: Watermarks{High: 0.2, Low: 0.8}},
+		{name: "negative low", interval: time.Second, marks: Watermarks{High: 0.8, Low: -0.2}},
+		{name: "high above one", interval: time.Second, marks: Watermarks{High: 1.5, Low: 0.2}},
+		{name: "NaN low", interval: time.Second, marks: Watermarks{High: 0.8, Low: math.NaN()}},
+		{name: "NaN high", interval: time.Second, marks: Watermarks{High: math.NaN(), Low: 0.2}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewMonitor(test.interval, test.marks); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+
+	// Equal watermarks are a single threshold without hysteresis.
+	if _, err := NewMonitor(time.Second, Watermarks{High: 0.5, Low: 0.5}); err != nil {
+		t.Fatal(err)
+	}
+}
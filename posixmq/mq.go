@@ -6,6 +6,7 @@ import (
     "github.com/bobcatalyst/go-mq/internal/deadline"
     "golang.org/x/sys/unix"
     "sync"
+    "time"
 )
 
 // MQ allows for structured usage of POSIX message queues.
@@ -15,11 +16,22 @@ type MQ struct {
     attr  *Attributes // Queue attributes, nil unless OpenCreate was passed as an oflag.
     mode  int         // Mode used when creating the queue.
     oflag OpenFlag    // Flags used to open the queue.
+    ns    *Namespace  // IPC namespace the queue is opened in, nil for the caller's namespace.
 
-    mqd    int          // Message queue descripto
-    buf    []byte       // Internal buffer for receiving messages.
-    close  func() error // Function to close the queue once.
-    unlink func() error // Function to unlink the queue once.
+    exactMode bool // Apply mode with fchmod after creating so the umask is ignored.
+
+    mqd    int           // Message queue descripto
+    buf    []byte        // Internal buffer for receiving messages.
+    close  func() error  // Function to close the queue once.
+    unlink func() error  // Function to unlink the queue once.
+    expiry *optionExpiry // How expired messages are handled on receive, nil uses the defaults.
+
+    schedOpts []SchedulerOption // Options used when creating the scheduler.
+    schedOnce sync.Once         // Guards lazy creation of the scheduler.
+    sched     *Scheduler        // Scheduler used by SendAt and SendAfter, nil until first used.
+    schedErr  error             // Error from creating the scheduler.
+
+    owner *MQ // Queue whose descriptor and scheduler are used, nil unless this is a view, see [MQ.view].
 }
 
 // MQOption represents options that can be applied when creating or opening a message queue.
@@ -29,6 +41,7 @@ type MQOption interface {
 
 type (
     optionOflag      OpenFlag
+    optionScheduler  []SchedulerOption
     optionCreateArgs struct {
         mode           int
         maxMessageSize int
@@ -48,7 +61,11 @@ func OptionCreateArgs(mode, maxMessageSize, maxQueueSize int) MQOption {
 // OptionOflag sets the oflag parameter for opening the queue.
 func OptionOflag(oflag OpenFlag) MQOption { return optionOflag(oflag) }
 
-func (opt optionOflag) applyOption(mq *MQ) { mq.oflag = OpenFlag(opt) }
+// OptionScheduler sets the options for the [Scheduler] used by [MQ.SendAt] and [MQ.SendAfter].
+func OptionScheduler(opts ...SchedulerOption) MQOption { return optionScheduler(opts) }
+
+func (opt optionOflag) applyOption(mq *MQ)     { mq.oflag = OpenFlag(opt) }
+func (opt optionScheduler) applyOption(mq *MQ) { mq.schedOpts = append(mq.schedOpts, opt...) }
 func (opt *optionCreateArgs) applyOption(mq *MQ) {
     mq.mode = opt.mode
     mq.attr = &Attributes{
@@ -105,39 +122,144 @@ func (mq *MQ) applyAll(opts []MQOption) error {
     return nil
 }
 
-// open initializes the queue and sets up close and unlink operations.
+// open opens the queue and sets up close and unlink operations.
 func (mq *MQ) open() (err error) {
-    if mq.mqd, err = rawOpen(mq.bname, mq.oflag, mq.mode, mq.attr); err != nil {
+    if mq.ns != nil {
+        // Keep a namespace descriptor of our own for unlinking, the caller may close theirs once the queue is open.
+        if mq.ns, err = mq.ns.dup(); err != nil {
+            return err
+        }
+        defer func() {
+            if err != nil {
+                err = errors.Join(err, mq.ns.Close())
+            }
+        }()
+    }
+
+    created := mq.oflag&(OpenCreate|OpenExclusive) == OpenCreate|OpenExclusive
+    if mq.exactMode && mq.oflag&OpenCreate == OpenCreate && !created {
+        // Only a queue created by this call may have its mode changed, so find out if it already exists.
+        mq.mqd, err = mq.rawOpen(mq.oflag | OpenExclusive)
+        created = err == nil
+        if errors.Is(err, ErrOpenExists{}) {
+            mq.mqd, err = mq.rawOpen(mq.oflag)
+        }
+    } else {
+        mq.mqd, err = mq.rawOpen(mq.oflag)
+    }
+    if err != nil {
         return err
     }
 
-    mq.unlink = func() error { return rawUnlink(mq.bname) }
-    mq.close = sync.OnceValue(func() error { return RawClose(mq.mqd) })
+    if mq.exactMode && created {
+        if err := RawChmod(mq.mqd, mq.mode); err != nil {
+            return errors.Join(err, RawClose(mq.mqd))
+        }
+    }
+    mq.setup()
     return nil
 }
 
+// rawOpen opens the queue with oflag, inside the queue's namespace if one is set.
+func (mq *MQ) rawOpen(oflag OpenFlag) (mqd int, err error) {
+    if mq.ns == nil {
+        return rawOpen(mq.bname, oflag, mq.mode, mq.attr)
+    }
+    err = mq.ns.Do(func() (err error) {
+        mqd, err = rawOpen(mq.bname, oflag, mq.mode, mq.attr)
+        return err
+    })
+    return mqd, err
+}
+
+// setup sets up close and unlink operations for an open queue.
+func (mq *MQ) setup() {
+    if mq.bname == nil {
+        mq.unlink = func() error { return ErrUnlinkNoName{} }
+    } else if ns := mq.ns; ns != nil {
+        mq.unlink = func() error { return ns.Do(func() error { return rawUnlink(mq.bname) }) }
+    } else {
+        mq.unlink = func() error { return rawUnlink(mq.bname) }
+    }
+    mq.close = sync.OnceValue(func() error {
+        // Prevent the scheduler from being created after the queue is closed.
+        mq.schedOnce.Do(func() { mq.schedErr = ErrSchedulerClosed{} })
+        var err error
+        if mq.sched != nil {
+            err = mq.sched.Close()
+        }
+        if mq.ns != nil {
+            err = errors.Join(err, mq.ns.Close())
+        }
+        return errors.Join(err, RawClose(mq.mqd))
+    })
+}
+
 // Send sends a message to the queue.
-func (mq *MQ) Send(dl deadline.Deadline, data []byte, priority uint) error {
-    _, err := RawSendReceive(mq.mqd, dl, data, priority)
+func (mq *MQ) Send(dl deadline.Deadline, data []byte, priority uint, opts ...SendOption) error {
+    _, err := RawSendReceive(mq.mqd, dl, encodeSendOptions(data, opts), priority)
     return err
 }
 
+// SendMessage sends a message to the queue, with its expiry if it has one.
+func (mq *MQ) SendMessage(dl deadline.Deadline, msg Message) error {
+    return mq.Send(dl, msg.Raw(), msg.Priority)
+}
+
+// SendAt schedules a message to be sent to the queue at t.
+// The message is held in memory, or on disk if [SchedulePersist] was passed to [OptionScheduler].
+func (mq *MQ) SendAt(t time.Time, data []byte, priority uint) (ScheduleID, error) {
+    s, err := mq.Scheduler()
+    if err != nil {
+        return 0, err
+    }
+    return s.SendAt(t, data, priority)
+}
+
+// SendAfter schedules a message to be sent to the queue once d has elapsed.
+func (mq *MQ) SendAfter(d time.Duration, data []byte, priority uint) (ScheduleID, error) {
+    s, err := mq.Scheduler()
+    if err != nil {
+        return 0, err
+    }
+    return s.SendAfter(d, data, priority)
+}
+
+// Scheduler returns the scheduler used by [MQ.SendAt] and [MQ.SendAfter], creating it on first use.
+// The scheduler is closed when the queue is closed.
+func (mq *MQ) Scheduler() (*Scheduler, error) {
+    if mq.owner != nil {
+        return mq.owner.Scheduler()
+    }
+    mq.schedOnce.Do(func() { mq.sched, mq.schedErr = NewScheduler(mq, mq.schedOpts...) })
+    return mq.sched, mq.schedErr
+}
+
 // Receive retrieves a message from the queue.
+// If the queue was opened with [OptionExpiry], expiry headers are removed and expired messages are discarded,
+// otherwise messages are returned exactly as they were sent.
 // The returned data is invalid after the next call to Receive.
 func (mq *MQ) Receive(dl deadline.Deadline) (data []byte, priority uint, _ error) {
+    msg, err := mq.ReceiveMessage(dl)
+    return msg.Data, msg.Priority, err
+}
+
+// ReceiveMessage is like [MQ.Receive], also returning when the message expires
+// if the queue was opened with [OptionExpiry].
+// The returned data is invalid after the next call to Receive or ReceiveMessage.
+func (mq *MQ) ReceiveMessage(dl deadline.Deadline) (Message, error) {
     if len(mq.buf) == 0 {
         // Receive buffer has not been initialized yet.
         // The only option changeable on an open message queue is blocking, so this only needs to be done once.
         attr, err := mq.GetAttr()
         if err != nil {
-            return nil, 0, fmt.Errorf("failed to get message buffer size from attributes: %w", err)
+            return Message{}, fmt.Errorf("failed to get message buffer size from attributes: %w", err)
         } else if attr.MaxMessageSize <= 0 {
-            return nil, 0, fmt.Errorf("invalid MaxMessageSize of %d", attr.MaxMessageSize)
+            return Message{}, fmt.Errorf("invalid MaxMessageSize of %d", attr.MaxMessageSize)
         }
         mq.buf = make([]byte, attr.MaxMessageSize)
     }
-    size, err := RawSendReceive(mq.mqd, dl, mq.buf, &priority)
-    return mq.buf[:size], priority, err
+    return mq.receiveMessageInto(dl, mq.buf)
 }
 
 // Name returns the name of the queue.
@@ -167,8 +289,9 @@ func (mq *MQ) Close() error {
 
 // Unlink closes and unlinks the queue. The system will free it once all processes close it.
 func (mq *MQ) Unlink() error {
-    err := mq.Close()
-    return errors.Join(err, mq.unlink())
+    // Unlink first, closing releases the namespace the queue is unlinked in.
+    err := mq.unlink()
+    return errors.Join(mq.Close(), err)
 }
 
 // GetAttr gets the message queue's attributes.
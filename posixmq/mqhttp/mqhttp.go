@@ -0,0 +1,315 @@
+// Package mqhttp exposes message queues over HTTP.
+//
+// The handler serves the following routes, where {name} is a queue name without its leading slash:
+//
+//	PUT    /queues/{name}           create the queue, with an optional JSON body of CreateRequest
+//	GET    /queues/{name}           the queue's posixmq.Attributes as JSON
+//	DELETE /queues/{name}           unlink the queue
+//	POST   /queues/{name}/messages  send the body as a message, ?priority=N&timeout=D
+//	GET    /queues/{name}/messages  receive a message, waiting up to ?timeout=D
+//
+// A received message is returned as the body with its priority in the X-Priority header.
+// If no message arrives before the timeout or the request's deadline, 204 No Content is returned.
+// Errors are returned as a JSON ErrorResponse, with a status code chosen by [StatusCode].
+package mqhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"github.com/bobcatalyst/go-mq/posixmq"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// PriorityHeader carries the priority of a received message.
+const PriorityHeader = "X-Priority"
+
+// StatusClientClosedRequest is returned when the client goes away before the request finishes.
+// It is not a standard status, the client never sees it, but it shows up in logs and middleware.
+const StatusClientClosedRequest = 499
+
+// CreateRequest is the optional body of a create request. Zero values use the system defaults.
+type CreateRequest struct {
+	Mode           int `json:"mode"`
+	MaxMessageSize int `json:"mq_msgsize"`
+	MaxQueueSize   int `json:"mq_maxmsg"`
+}
+
+// ErrorResponse is the body of an error response.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Option represents options that can be applied when creating a [Handler].
+type Option interface {
+	applyOption(*Handler)
+}
+
+type (
+	optionMaxWait    time.Duration
+	optionCreateMode int
+)
+
+// OptionMaxWait limits how long a receive waits for a message, default 60s.
+func OptionMaxWait(d time.Duration) Option { return optionMaxWait(d) }
+
+// OptionCreateMode sets the mode of created queues when the request does not give one, default 0600.
+func OptionCreateMode(mode int) Option { return optionCreateMode(mode) }
+
+func (opt optionMaxWait) applyOption(h *Handler)    { h.maxWait = time.Duration(opt) }
+func (opt optionCreateMode) applyOption(h *Handler) { h.createMode = int(opt) }
+
+// Handler is an [http.Handler] exposing message queues.
+type Handler struct {
+	mux        *http.ServeMux
+	maxWait    time.Duration
+	createMode int
+}
+
+// NewHandler creates a handler.
+func NewHandler(opts ...Option) *Handler {
+	h := &Handler{mux: http.NewServeMux(), maxWait: time.Minute, createMode: 0600}
+	for _, opt := range opts {
+		opt.applyOption(h)
+	}
+	h.mux.HandleFunc("PUT /queues/{name}", h.create)
+	h.mux.HandleFunc("GET /queues/{name}", h.attributes)
+	h.mux.HandleFunc("DELETE /queues/{name}", h.unlink)
+	h.mux.HandleFunc("POST /queues/{name}/messages", h.send)
+	h.mux.HandleFunc("GET /queues/{name}/messages", h.receive)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// StatusCode maps an error from posixmq to an HTTP status code.
+func StatusCode(err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return StatusClientClosedRequest
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, posixmq.ErrOpenNoEntry{}), errors.Is(err, posixmq.ErrUnlinkNoMessageQueue{}):
+		return http.StatusNotFound
+	case errors.Is(err, posixmq.ErrOpenExists{}):
+		return http.StatusConflict
+	case errors.Is(err, posixmq.ErrOpenBadAccess{}), errors.Is(err, posixmq.ErrUnlinkNoPermission{}):
+		return http.StatusForbidden
+	case errors.Is(err, posixmq.ErrSendInvalidMessageSize{}):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, posixmq.ErrSendFullQueue{}), errors.Is(err, posixmq.ErrSendRecvTimeout{}):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, posixmq.ErrOpenProcessLimitReached{}), errors.Is(err, posixmq.ErrOpenSystemLimitReached{}),
+		errors.Is(err, posixmq.ErrOpenNoSpace{}), errors.Is(err, posixmq.ErrNoMemory{}):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, posixmq.ErrNameInvalid{}), errors.Is(err, posixmq.ErrNameEmpty{}),
+		errors.Is(err, posixmq.ErrNameContainedMultipleSlash{}), errors.Is(err, posixmq.ErrNameTooLong{}),
+		errors.Is(err, posixmq.ErrOpenInvalid{}), errors.As(err, new(badRequest)):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// badRequest is an invalid parameter or body in a request.
+type badRequest struct{ err error }
+
+func (err badRequest) Error() string { return err.err.Error() }
+func (err badRequest) Unwrap() error { return err.err }
+
+func writeError(w http.ResponseWriter, err error) {
+	status := StatusCode(err)
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "1")
+	}
+	writeJSON(w, status, ErrorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// open opens the queue named in the request path.
+func open(r *http.Request, oflag posixmq.OpenFlag) (*posixmq.MQ, error) {
+	return posixmq.New("/"+r.PathValue("name"), posixmq.OptionOflag(oflag|posixmq.OpenCloseOnExec))
+}
+
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
+	req := CreateRequest{Mode: h.createMode}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, badRequest{fmt.Errorf("invalid create request: %w", err)})
+		return
+	}
+
+	var err error
+	if req.MaxMessageSize == 0 {
+		if req.MaxMessageSize, err = posixmq.DefaultMessageSize(); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	if req.MaxQueueSize == 0 {
+		if req.MaxQueueSize, err = posixmq.DefaultQueueSize(); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+
+	mq, err := posixmq.New("/"+r.PathValue("name"),
+		posixmq.OptionCreateArgs(req.Mode, req.MaxMessageSize, req.MaxQueueSize),
+		posixmq.OptionOflag(posixmq.OpenReadOnly|posixmq.OpenExclusive|posixmq.OpenCloseOnExec),
+		posixmq.OptionExactMode(),
+	)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer mq.Close()
+	attr, err := mq.GetAttr()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, attr)
+}
+
+func (h *Handler) attributes(w http.ResponseWriter, r *http.Request) {
+	mq, err := open(r, posixmq.OpenReadOnly)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer mq.Close()
+	attr, err := mq.GetAttr()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, attr)
+}
+
+func (h *Handler) unlink(w http.ResponseWriter, r *http.Request) {
+	if err := posixmq.RawUnlink("/" + r.PathValue("name")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) send(w http.ResponseWriter, r *http.Request) {
+	var priority uint64
+	if p := r.URL.Query().Get("priority"); p != "" {
+		var err error
+		if priority, err = strconv.ParseUint(p, 10, 32); err != nil {
+			writeError(w, badRequest{fmt.Errorf("invalid priority: %w", err)})
+			return
+		} else if priority > posixmq.MaxPriority {
+			writeError(w, badRequest{fmt.Errorf("invalid priority %d, the maximum is %d", priority, posixmq.MaxPriority)})
+			return
+		}
+	}
+	// Without a timeout a full queue is reported straight away.
+	dl, err := h.deadline(r, 0)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	mq, err := open(r, posixmq.OpenWriteOnly)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer mq.Close()
+	attr, err := mq.GetAttr()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(attr.MaxMessageSize)))
+	if errors.As(err, new(*http.MaxBytesError)) {
+		writeError(w, fmt.Errorf("%w, the queue's limit is %d bytes", posixmq.ErrSendInvalidMessageSize{}, attr.MaxMessageSize))
+		return
+	} else if err != nil {
+		writeError(w, badRequest{err})
+		return
+	}
+
+	if err := waitFor(r.Context(), dl, func(dl deadline.Deadline) error { return mq.Send(dl, data, uint(priority)) }); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) receive(w http.ResponseWriter, r *http.Request) {
+	dl, err := h.deadline(r, h.maxWait)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	mq, err := open(r, posixmq.OpenReadOnly)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer mq.Close()
+
+	var data []byte
+	var priority uint
+	err = waitFor(r.Context(), dl, func(dl deadline.Deadline) (err error) {
+		data, priority, err = mq.Receive(dl)
+		return err
+	})
+	if errors.Is(err, posixmq.ErrSendRecvTimeout{}) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	} else if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set(PriorityHeader, strconv.FormatUint(uint64(priority), 10))
+	w.Write(data)
+}
+
+// deadline returns when an operation must finish, from the timeout parameter, falling back to def,
+// limited by the handler's max wait and the request's deadline.
+func (h *Handler) deadline(r *http.Request, def time.Duration) (time.Time, error) {
+	timeout := def
+	if t := r.URL.Query().Get("timeout"); t != "" {
+		var err error
+		if timeout, err = time.ParseDuration(t); err != nil {
+			return time.Time{}, badRequest{fmt.Errorf("invalid timeout: %w", err)}
+		}
+	}
+	dl := time.Now().Add(min(timeout, h.maxWait))
+	if t, ok := r.Context().Deadline(); ok && t.Before(dl) {
+		dl = t
+	}
+	return dl, nil
+}
+
+// waitFor retries op in steps of [deadline.PollInterval] until dl, so a cancelled request stops waiting.
+func waitFor(ctx context.Context, dl time.Time, op func(deadline.Deadline) error) error {
+	stepCtx, cancel := context.WithDeadline(ctx, dl)
+	defer cancel()
+	for {
+		err := op(deadline.Step(stepCtx, deadline.PollInterval))
+		if !errors.Is(err, posixmq.ErrSendRecvTimeout{}) || !time.Now().Before(dl) {
+			return err
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package mqhttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/posixmq"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T) (url, name string) {
+	t.Helper()
+	srv := httptest.NewServer(NewHandler(OptionMaxWait(time.Second * 5)))
+	t.Cleanup(srv.Close)
+	name = fmt.Sprintf("/mqhttp-%d.tmp", rand.Uint64())
+	t.Cleanup(func() { posixmq.RawUnlink(name) })
+	return srv.URL + "/queues" + name, name
+}
+
+func do(t *testing.T, method, url, body string, expected int) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != expected {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("%s %s: expected status %d, got %d: %s", method, url, expected, resp.StatusCode, b)
+	}
+	return resp
+}
+
+func TestHandler(t *testing.T) {
+	url, _ := newTestServer(t)
+
+	do(t, http.MethodGet, url, "", http.StatusNotFound)
+	do(t, http.MethodPut, url, `{"mq_msgsize":16,"mq_maxmsg":2}`, http.StatusCreated)
+	do(t, http.MethodPut, url, "", http.StatusConflict)
+
+	var attr posixmq.Attributes
+	if err := json.NewDecoder(do(t, http.MethodGet, url, "", http.StatusOK).Body).Decode(&attr); err != nil {
+		t.Fatal(err)
+	} else if attr.MaxMessageSize != 16 || attr.MaxQueueSize != 2 {
+		t.Fatalf("unexpected attributes %+v", attr)
+	}
+
+	do(t, http.MethodPost, url+"/messages?priority=1", "low", http.StatusNoContent)
+	do(t, http.MethodPost, url+"/messages?priority=5", "high", http.StatusNoContent)
+	if resp := do(t, http.MethodPost, url+"/messages", "full", http.StatusServiceUnavailable); resp.Header.Get("Retry-After") == "" {
+		t.Fatal("expected Retry-After on a full queue")
+	}
+	do(t, http.MethodPost, url+"/messages", strings.Repeat("x", 17), http.StatusRequestEntityTooLarge)
+	do(t, http.MethodPost, url+"/messages?priority=x", "bad", http.StatusBadRequest)
+	do(t, http.MethodPost, url+"/messages?priority=40000", "bad", http.StatusBadRequest)
+
+	for _, expected := range []struct {
+		data     string
+		priority string
+	}{{"high", "5"}, {"low", "1"}} {
+		resp := do(t, http.MethodGet, url+"/messages", "", http.StatusOK)
+		if b, _ := io.ReadAll(resp.Body); string(b) != expected.data {
+			t.Fatalf("expected %q, got %q", expected.data, b)
+		} else if p := resp.Header.Get(PriorityHeader); p != expected.priority {
+			t.Fatalf("expected priority %s, got %s", expected.priority, p)
+		}
+	}
+
+	do(t, http.MethodGet, url+"/messages?timeout=10ms", "", http.StatusNoContent)
+	do(t, http.MethodDelete, url, "", http.StatusNoContent)
+	do(t, http.MethodDelete, url, "", http.StatusNotFound)
+}
+
+func TestHandler_Cancelled(t *testing.T) {
+	name := fmt.Sprintf("/mqhttp-%d.tmp", rand.Uint64())
+	mq, err := posixmq.New(name, posixmq.OptionOflag(posixmq.OpenReadOnly|posixmq.OpenCreate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mq.Unlink()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/queues"+name+"/messages?timeout=2s", nil)
+	rec := httptest.NewRecorder()
+	NewHandler().ServeHTTP(rec, req)
+	if rec.Code != StatusClientClosedRequest {
+		t.Fatalf("expected status %d, got %d: %s", StatusClientClosedRequest, rec.Code, rec.Body)
+	}
+}
+
+func TestHandler_LongPoll(t *testing.T) {
+	url, name := newTestServer(t)
+	do(t, http.MethodPut, url, "", http.StatusCreated)
+
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		mq, err := posixmq.New(name, posixmq.OptionOflag(posixmq.OpenWriteOnly))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer mq.Close()
+		if err := mq.Send(t, []byte("late"), 0); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	start := time.Now()
+	resp := do(t, http.MethodGet, url+"/messages?timeout=2s", "", http.StatusOK)
+	if b, _ := io.ReadAll(resp.Body); string(b) != "late" {
+		t.Fatalf("expected late, got %q", b)
+	} else if time.Since(start) < time.Millisecond*100 {
+		t.Fatal("expected receive to wait for the message")
+	}
+}
@@ -0,0 +1,250 @@
+package mqnet
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"github.com/bobcatalyst/go-mq/posixmq"
+	"golang.org/x/sys/unix"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// closeTimeout is how long Close waits for room to send the end of stream to the peer.
+const closeTimeout = time.Millisecond * 100
+
+// The listener answers a connection request with a handshake message on the dialer's down queue, ahead of the stream.
+const (
+	handshakeAccept byte = iota // The connection was accepted.
+	handshakeReject             // The connection was refused, the rest of the message is the reason.
+)
+
+// Conn is a connection over a pair of queues.
+//
+// A peer closing the connection is seen as [io.EOF] by Read. Writes are not told about it,
+// so once the queue fills up they block until the write deadline.
+type Conn struct {
+	local, remote Addr
+	rmq, wmq      *posixmq.MQ
+	r             *posixmq.Reader
+	w             *posixmq.Writer
+	rw, ww        *waiter
+	unlink        []string // Names the dialer unlinks on close, in case the listener never accepted.
+
+	readMu  sync.Mutex   // Serializes reads, the reader is not safe for concurrent use.
+	writeMu sync.Mutex   // Serializes writes.
+	inUse   sync.RWMutex // Held for reading by operations, so descriptors are not closed while they are used.
+	closed  atomic.Bool
+	close   func() error
+}
+
+func newConn(local, remote Addr, rmq, wmq *posixmq.MQ, unlink []string) (_ *Conn, err error) {
+	c := &Conn{local: local, remote: remote, rmq: rmq, wmq: wmq, r: posixmq.NewReader(rmq), w: posixmq.NewWriter(wmq), unlink: unlink}
+	if c.rw, err = newWaiter(); err != nil {
+		return nil, err
+	}
+	if c.ww, err = newWaiter(); err != nil {
+		return nil, errors.Join(err, c.rw.close())
+	}
+	// Reads and writes never block in the queue, blocking is done with poll so it can be interrupted.
+	_ = c.r.SetDeadline(time.Time(deadline.Past))
+	_ = c.w.SetDeadline(time.Time(deadline.Past))
+	c.close = sync.OnceValue(c.doClose)
+	return c, nil
+}
+
+// Dial connects to the listener on the queue name, waiting for the listener to accept the connection.
+// If dl passes first, [posixmq.ErrSendRecvTimeout] is returned. If dl is a [context.Context],
+// cancelling it stops waiting and returns its error.
+func Dial(dl deadline.Deadline, name string, opts ...Option) (net.Conn, error) {
+	c, err := newConfig(opts)
+	if err != nil {
+		return nil, dialErr(name, err)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, dialErr(name, err)
+	}
+	base := name + "." + hex.EncodeToString(id)
+	up, down := base+".up", base+".down"
+
+	create := posixmq.OptionCreateArgs(c.mode, c.maxMessageSize, c.maxQueueSize)
+	wmq, err := posixmq.New(up, create, posixmq.OptionOflag(posixmq.OpenWriteOnly|posixmq.OpenExclusive|posixmq.OpenCloseOnExec))
+	if err != nil {
+		return nil, dialErr(name, err)
+	}
+	rmq, err := posixmq.New(down, create, posixmq.OptionOflag(posixmq.OpenReadOnly|posixmq.OpenExclusive|posixmq.OpenCloseOnExec))
+	if err != nil {
+		return nil, dialErr(name, errors.Join(err, wmq.Unlink()))
+	}
+	fail := func(err error) (net.Conn, error) {
+		return nil, dialErr(name, errors.Join(err, wmq.Unlink(), rmq.Unlink()))
+	}
+
+	srv, err := posixmq.New(name, posixmq.OptionOflag(posixmq.OpenWriteOnly|posixmq.OpenCloseOnExec))
+	if errors.Is(err, posixmq.ErrOpenNoEntry{}) {
+		return fail(unix.ECONNREFUSED)
+	} else if err != nil {
+		return fail(err)
+	}
+	err = srv.Send(dl, []byte(base), 0)
+	if err = errors.Join(err, srv.Close()); err != nil {
+		return fail(err)
+	}
+	if err := receiveHandshake(dl, rmq); err != nil {
+		// The listener may accept the request later, end the stream so it does not wait for data.
+		w := posixmq.NewWriter(wmq)
+		_ = w.SetDeadline(time.Time(deadline.Past))
+		_ = w.Close()
+		return fail(err)
+	}
+
+	conn, err := newConn(Addr(base), Addr(name), rmq, wmq, []string{up, down})
+	if err != nil {
+		return fail(err)
+	}
+	return conn, nil
+}
+
+// receiveHandshake waits for the listener to answer the connection request.
+func receiveHandshake(dl deadline.Deadline, rmq *posixmq.MQ) error {
+	ctx, _ := dl.(context.Context)
+	for {
+		step := dl
+		if ctx != nil {
+			step = deadline.Step(ctx, deadline.PollInterval)
+		}
+		data, _, err := rmq.Receive(step)
+		if errors.Is(err, posixmq.ErrSendRecvTimeout{}) && ctx != nil {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		} else if len(data) == 0 {
+			return errors.New("received an empty handshake")
+		}
+
+		switch data[0] {
+		case handshakeAccept:
+			return nil
+		case handshakeReject:
+			return fmt.Errorf("connection rejected: %s: %w", data[1:], unix.ECONNREFUSED)
+		default:
+			return fmt.Errorf("received an invalid handshake of type %d", data[0])
+		}
+	}
+}
+
+func dialErr(name string, err error) error {
+	return &net.OpError{Op: "dial", Net: Network, Addr: Addr(name), Err: err}
+}
+
+// Read reads data from the connection.
+func (c *Conn) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	c.inUse.RLock()
+	defer c.inUse.RUnlock()
+
+	for {
+		if c.closed.Load() {
+			return 0, c.opErr("read", net.ErrClosed)
+		}
+		n, err := c.r.Read(p)
+		if err == io.EOF {
+			return n, err
+		} else if !errors.Is(err, posixmq.ErrSendRecvTimeout{}) {
+			return n, c.opErr("read", err)
+		} else if err := c.rw.wait(c.rmq.Mqd(), unix.POLLIN, &c.closed); err != nil {
+			return 0, c.opErr("read", err)
+		}
+	}
+}
+
+// Write writes data to the connection.
+func (c *Conn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.inUse.RLock()
+	defer c.inUse.RUnlock()
+
+	total := 0
+	for {
+		if c.closed.Load() {
+			return total, c.opErr("write", net.ErrClosed)
+		}
+		n, err := c.w.Write(p)
+		total += n
+		p = p[n:]
+		if !errors.Is(err, posixmq.ErrSendRecvTimeout{}) {
+			return total, c.opErr("write", err)
+		} else if err := c.ww.wait(c.wmq.Mqd(), unix.POLLOUT, &c.closed); err != nil {
+			return total, c.opErr("write", err)
+		}
+	}
+}
+
+// Close sends the end of stream to the peer and closes the connection.
+// Blocked reads and writes return [net.ErrClosed].
+func (c *Conn) Close() error {
+	return c.close()
+}
+
+func (c *Conn) doClose() error {
+	c.closed.Store(true)
+	c.rw.wake()
+	c.ww.wake()
+	c.inUse.Lock()
+	defer c.inUse.Unlock()
+
+	_ = c.w.SetDeadline(time.Now().Add(closeTimeout))
+	err := c.w.Close()
+	if errors.Is(err, posixmq.ErrSendRecvTimeout{}) {
+		// The peer is not reading, it will not miss the end of stream.
+		err = nil
+	}
+	err = errors.Join(err, c.rmq.Close(), c.wmq.Close(), c.rw.close(), c.ww.close())
+	for _, name := range c.unlink {
+		if uerr := posixmq.RawUnlink(name); uerr != nil && !errors.Is(uerr, posixmq.ErrUnlinkNoMessageQueue{}) {
+			err = errors.Join(err, uerr)
+		}
+	}
+	return c.opErr("close", err)
+}
+
+func (c *Conn) LocalAddr() net.Addr  { return c.local }
+func (c *Conn) RemoteAddr() net.Addr { return c.remote }
+
+// SetDeadline sets the read and write deadlines, interrupting pending reads and writes that pass it.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.rw.setDeadline(t)
+	c.ww.setDeadline(t)
+	return nil
+}
+
+// SetReadDeadline sets the read deadline, after which reads return [os.ErrDeadlineExceeded].
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.rw.setDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline sets the write deadline, after which writes return [os.ErrDeadlineExceeded].
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.ww.setDeadline(t)
+	return nil
+}
+
+func (c *Conn) opErr(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &net.OpError{Op: op, Net: Network, Source: c.local, Addr: c.remote, Err: err}
+}
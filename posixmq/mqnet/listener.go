@@ -0,0 +1,141 @@
+package mqnet
+
+import (
+	"errors"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"github.com/bobcatalyst/go-mq/posixmq"
+	"golang.org/x/sys/unix"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// requestSize is the message size of a listener's queue, which receives the names of dialers' queues.
+const requestSize = 256
+
+// Listener accepts connections requested on a server queue.
+type Listener struct {
+	name string
+	mq   *posixmq.MQ
+	w    *waiter
+
+	acceptMu sync.Mutex   // Serializes accepts, receiving from the queue is not safe for concurrent use.
+	inUse    sync.RWMutex // Held for reading by Accept, so descriptors are not closed while it is used.
+	closed   atomic.Bool
+	close    func() error
+}
+
+// Listen creates the server queue name and listens for connections on it.
+// The queue is unlinked when the listener is closed.
+func Listen(name string, opts ...Option) (*Listener, error) {
+	c, err := newConfig(opts)
+	if err != nil {
+		return nil, listenErr(name, err)
+	}
+	mq, err := posixmq.New(name,
+		posixmq.OptionCreateArgs(c.mode, requestSize, c.maxQueueSize),
+		posixmq.OptionOflag(posixmq.OpenReadOnly|posixmq.OpenCloseOnExec),
+	)
+	if err != nil {
+		return nil, listenErr(name, err)
+	}
+	w, err := newWaiter()
+	if err != nil {
+		return nil, listenErr(name, errors.Join(err, mq.Unlink()))
+	}
+	l := &Listener{name: name, mq: mq, w: w}
+	l.close = sync.OnceValue(l.doClose)
+	return l, nil
+}
+
+func listenErr(name string, err error) error {
+	return &net.OpError{Op: "listen", Net: Network, Addr: Addr(name), Err: err}
+}
+
+// Accept waits for and returns the next connection.
+// Requests from dialers that gave up before being accepted are skipped.
+func (l *Listener) Accept() (net.Conn, error) {
+	l.acceptMu.Lock()
+	defer l.acceptMu.Unlock()
+	l.inUse.RLock()
+	defer l.inUse.RUnlock()
+
+	for {
+		if l.closed.Load() {
+			return nil, l.opErr("accept", net.ErrClosed)
+		}
+		data, _, err := l.mq.Receive(deadline.Past)
+		if err == nil {
+			if c, err := l.accept(string(data)); err == nil {
+				return c, nil
+			}
+			continue
+		} else if !errors.Is(err, posixmq.ErrSendRecvTimeout{}) {
+			return nil, l.opErr("accept", err)
+		} else if err := l.w.wait(l.mq.Mqd(), unix.POLLIN, &l.closed); err != nil {
+			return nil, l.opErr("accept", err)
+		}
+	}
+}
+
+// accept opens the queues of a dialer and unlinks them, so no one else can open them,
+// then answers the dialer with a handshake.
+func (l *Listener) accept(base string) (*Conn, error) {
+	if !strings.HasPrefix(base, l.name+".") || strings.Contains(base[1:], "/") {
+		return nil, posixmq.ErrNameInvalid{}
+	}
+	up, down := base+".up", base+".down"
+	rmq, err := posixmq.New(up, posixmq.OptionOflag(posixmq.OpenReadOnly|posixmq.OpenCloseOnExec))
+	if err != nil {
+		return nil, err
+	}
+	wmq, err := posixmq.New(down, posixmq.OptionOflag(posixmq.OpenWriteOnly|posixmq.OpenCloseOnExec))
+	if err != nil {
+		return nil, errors.Join(err, rmq.Close())
+	}
+	// Failures from here on are reported to the dialer, which is waiting for the handshake.
+	reject := func(err error) (*Conn, error) {
+		_ = wmq.Send(deadline.Past, append([]byte{handshakeReject}, err.Error()...), 0)
+		return nil, errors.Join(err, rmq.Close(), wmq.Close())
+	}
+	if err := errors.Join(posixmq.RawUnlink(up), posixmq.RawUnlink(down)); err != nil {
+		return reject(err)
+	}
+
+	c, err := newConn(Addr(l.name), Addr(base), rmq, wmq, nil)
+	if err != nil {
+		return reject(err)
+	}
+	// The queue was just created by the dialer, so there is room for the handshake.
+	if err := wmq.Send(deadline.Past, []byte{handshakeAccept}, 0); err != nil {
+		return nil, errors.Join(err, c.Close())
+	}
+	return c, nil
+}
+
+// Close stops listening and unlinks the server queue. A blocked Accept returns [net.ErrClosed].
+// Connections already accepted are not closed.
+func (l *Listener) Close() error {
+	return l.close()
+}
+
+func (l *Listener) doClose() error {
+	l.closed.Store(true)
+	l.w.wake()
+	l.inUse.Lock()
+	defer l.inUse.Unlock()
+	return l.opErr("close", errors.Join(l.mq.Unlink(), l.w.close()))
+}
+
+// Addr returns the name of the server queue.
+func (l *Listener) Addr() net.Addr {
+	return Addr(l.name)
+}
+
+func (l *Listener) opErr(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &net.OpError{Op: op, Net: Network, Addr: Addr(l.name), Err: err}
+}
@@ -0,0 +1,148 @@
+// Package mqnet implements [net.Conn] and [net.Listener] over POSIX message queues,
+// for running protocols such as net/http or net/rpc between local processes without sockets.
+//
+// A [Listener] receives connection requests on a named server queue. Each connection uses a private pair of
+// queues created by the dialer, one for each direction, carrying a byte stream framed by [posixmq.Writer].
+// The pair is unlinked once the listener accepts the connection, so only the two ends can use it.
+// The listener then answers with a handshake message ahead of the stream, so dialing fails if the connection
+// could not be set up.
+package mqnet
+
+import (
+	"errors"
+	"github.com/bobcatalyst/go-mq/posixmq"
+	"golang.org/x/sys/unix"
+	"math"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Network is the name of the network reported by addresses.
+const Network = "posixmq"
+
+// Addr is the name of a queue used as an address.
+type Addr string
+
+func (Addr) Network() string  { return Network }
+func (a Addr) String() string { return string(a) }
+
+// Option represents options that can be applied when listening or dialing.
+type Option interface {
+	applyOption(*config)
+}
+
+type config struct {
+	mode           int
+	maxMessageSize int
+	maxQueueSize   int
+}
+
+type optionQueueArgs config
+
+// OptionQueueArgs sets the mode and attributes of the queues created for connections.
+// The mode also applies to the listener's queue, and must let dialing processes write to it.
+// By default the mode is 0600 and the attributes are the system defaults.
+func OptionQueueArgs(mode, maxMessageSize, maxQueueSize int) Option {
+	return optionQueueArgs{mode: mode, maxMessageSize: maxMessageSize, maxQueueSize: maxQueueSize}
+}
+
+func (opt optionQueueArgs) applyOption(c *config) { *c = config(opt) }
+
+func newConfig(opts []Option) (config, error) {
+	c := config{mode: 0600}
+	for _, opt := range opts {
+		opt.applyOption(&c)
+	}
+
+	var err error
+	if c.maxMessageSize == 0 {
+		if c.maxMessageSize, err = posixmq.DefaultMessageSize(); err != nil {
+			return config{}, err
+		}
+	}
+	if c.maxQueueSize == 0 {
+		if c.maxQueueSize, err = posixmq.DefaultQueueSize(); err != nil {
+			return config{}, err
+		}
+	}
+	return c, nil
+}
+
+// waiter waits for a queue to become ready, until its deadline passes or it is woken to re-read the deadline.
+type waiter struct {
+	wakefd int
+
+	mu       sync.Mutex
+	deadline time.Time
+	closed   bool
+}
+
+func newWaiter() (*waiter, error) {
+	fd, err := unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	return &waiter{wakefd: fd}, nil
+}
+
+// setDeadline changes the deadline, waking a pending wait.
+func (w *waiter) setDeadline(t time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.deadline = t
+	w.wakeLocked()
+}
+
+func (w *waiter) wake() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.wakeLocked()
+}
+
+func (w *waiter) wakeLocked() {
+	if !w.closed {
+		_, _ = unix.Write(w.wakefd, []byte{1, 0, 0, 0, 0, 0, 0, 0})
+	}
+}
+
+// wait blocks until fd has events, returning [os.ErrDeadlineExceeded] or [net.ErrClosed] if it stops waiting first.
+func (w *waiter) wait(fd int, events int16, closed *atomic.Bool) error {
+	fds := []unix.PollFd{{Fd: int32(fd), Events: events}, {Fd: int32(w.wakefd), Events: unix.POLLIN}}
+	for {
+		if closed.Load() {
+			return net.ErrClosed
+		}
+
+		w.mu.Lock()
+		t := w.deadline
+		w.mu.Unlock()
+		timeout := -1
+		if !t.IsZero() {
+			d := time.Until(t)
+			if d <= 0 {
+				return os.ErrDeadlineExceeded
+			}
+			timeout = int(min(math.Ceil(float64(d)/float64(time.Millisecond)), math.MaxInt32))
+		}
+
+		if _, err := unix.Poll(fds, timeout); err != nil && !errors.Is(err, unix.EINTR) {
+			return err
+		} else if fds[1].Revents != 0 {
+			var buf [8]byte
+			_, _ = unix.Read(w.wakefd, buf[:])
+		} else if fds[0].Revents != 0 {
+			return nil
+		}
+	}
+}
+
+// close closes the eventfd, it must not be waiting.
+func (w *waiter) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	return unix.Close(w.wakefd)
+}
@@ -0,0 +1,151 @@
+package mqnet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"github.com/bobcatalyst/go-mq/posixmq"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testOpts = []Option{OptionQueueArgs(0600, 1024, 10)}
+
+func newTestListener(t *testing.T) *Listener {
+	t.Helper()
+	l, err := Listen(fmt.Sprintf("/mqnet-%d.tmp", rand.Uint64()), testOpts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func TestHTTP(t *testing.T) {
+	l := newTestListener(t)
+	body := strings.Repeat("hello over a queue ", 500)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %d %s", r.Method, len(b), body)
+	})}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return Dial(ctx, l.Addr().String(), testOpts...)
+		},
+	}}
+	defer client.CloseIdleConnections()
+
+	for range 3 {
+		resp, err := client.Post("http://mq/", "text/plain", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		} else if expected := fmt.Sprintf("POST %d %s", len(body), body); string(got) != expected {
+			t.Fatalf("unexpected response of %d bytes", len(got))
+		}
+	}
+}
+
+func TestConn_Deadline(t *testing.T) {
+	l := newTestListener(t)
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- c
+	}()
+
+	c, err := Dial(t, l.Addr().String(), testOpts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	s := <-accepted
+	if s == nil {
+		t.FailNow()
+	}
+
+	// A pending read is interrupted by moving the deadline, the way net/http aborts background reads.
+	errc := make(chan error, 1)
+	go func() {
+		_, err := c.Read(make([]byte, 1))
+		errc <- err
+	}()
+	time.Sleep(time.Millisecond * 10)
+	c.SetReadDeadline(time.Unix(1, 0))
+	select {
+	case err := <-errc:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("expected os.ErrDeadlineExceeded, got %v", err)
+		} else if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+			t.Fatalf("expected a timeout net.Error, got %v", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("read was not interrupted")
+	}
+
+	// Closing the peer ends the stream.
+	c.SetReadDeadline(time.Time{})
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestListener_Close(t *testing.T) {
+	l := newTestListener(t)
+	errc := make(chan error, 1)
+	go func() {
+		_, err := l.Accept()
+		errc <- err
+	}()
+	time.Sleep(time.Millisecond * 10)
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errc:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Fatalf("expected net.ErrClosed, got %v", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("accept was not interrupted")
+	}
+
+	if _, err := Dial(t, l.Addr().String(), testOpts...); err == nil {
+		t.Fatal("expected dialing a closed listener to fail")
+	}
+}
+
+func TestDial_NotAccepted(t *testing.T) {
+	l := newTestListener(t)
+
+	// Dialing waits for the listener to accept the connection.
+	dl := deadline.TimeDeadline(time.Now().Add(time.Millisecond * 50))
+	if _, err := Dial(dl, l.Addr().String(), testOpts...); !errors.Is(err, posixmq.ErrSendRecvTimeout{}) {
+		t.Fatalf("expected ErrSendRecvTimeout, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*50, cancel)
+	if _, err := Dial(ctx, l.Addr().String(), testOpts...); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,285 @@
+package posixmq
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"golang.org/x/sys/unix"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MuxPolicy decides which queue a [Mux] receives from when several have messages.
+type MuxPolicy int
+
+const (
+	// MuxRoundRobin takes turns between ready queues so none can starve the others.
+	MuxRoundRobin MuxPolicy = iota
+	// MuxPriority receives the highest priority message across all ready queues,
+	// using round-robin order between queues whose head messages have equal priority.
+	// Messages are compared once they have been received, see [Mux].
+	MuxPriority
+)
+
+// ErrMuxClosed is returned when receiving from a [Mux] that has been closed.
+type ErrMuxClosed struct{}
+
+func (ErrMuxClosed) Error() string {
+	return "the mux has been closed"
+}
+
+// Mux waits on many queues at once using epoll and receives from whichever is ready.
+//
+// The kernel has no way to look at a message without receiving it, so to compare priorities across queues
+// [MuxPriority] receives the head message of each ready queue and holds it until a later Receive returns it.
+// At most one message per queue is held outside its queue at any time. Held messages are never sent back,
+// as that would reorder them behind their peers: [Mux.Remove] hands the held message of a queue to the caller,
+// and [Mux.Close] discards any that are left, so remove the queues first to keep them.
+type Mux struct {
+	policy MuxPolicy
+	epfd   int
+	wakefd int // eventfd used to interrupt a blocked Receive when closing.
+
+	mu      sync.Mutex
+	queues  []*muxQueue
+	byMqd   map[int]*muxQueue
+	next    int // Round-robin position in queues.
+	waiting int // Number of Receive calls blocked in epoll_wait.
+	closed  bool
+}
+
+// muxQueue is a queue in a Mux and the message held from it.
+type muxQueue struct {
+	mq   *MQ
+	buf  []byte
+	held bool
+	msg  Message
+	err  error // Returned with msg, set for messages received with ErrExpiryMissing.
+}
+
+// NewMux creates a mux receiving from mqs.
+func NewMux(policy MuxPolicy, mqs ...*MQ) (_ *Mux, err error) {
+	m := &Mux{policy: policy, byMqd: map[int]*muxQueue{}}
+	if m.epfd, err = unix.EpollCreate1(unix.EPOLL_CLOEXEC); err != nil {
+		return nil, err
+	}
+	if m.wakefd, err = unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK); err != nil {
+		return nil, errors.Join(err, unix.Close(m.epfd))
+	}
+	if err := unix.EpollCtl(m.epfd, unix.EPOLL_CTL_ADD, m.wakefd, &unix.EpollEvent{Events: unix.EPOLLIN, Fd: int32(m.wakefd)}); err != nil {
+		return nil, errors.Join(err, m.Close())
+	}
+
+	for _, mq := range mqs {
+		if err := m.Add(mq); err != nil {
+			return nil, errors.Join(err, m.Close())
+		}
+	}
+	return m, nil
+}
+
+// Select receives the next message from whichever of mqs is ready first, preferring earlier queues when several are.
+// Priorities are not compared across queues, as that would take messages from queues that were not selected.
+// When receiving repeatedly from the same queues, or to compare priorities, use a [Mux] instead.
+func Select(dl deadline.Deadline, mqs ...*MQ) (*MQ, []byte, uint, error) {
+	m, err := NewMux(MuxRoundRobin, mqs...)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	// Round-robin only receives the message it returns, so nothing is held when the mux is closed.
+	mq, data, priority, err := m.Receive(dl)
+	return mq, data, priority, errors.Join(err, m.Close())
+}
+
+// Add starts receiving from mq.
+func (m *Mux) Add(mq *MQ) error {
+	attr, err := mq.GetAttr()
+	if err != nil {
+		return fmt.Errorf("failed to get message buffer size from attributes: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrMuxClosed{}
+	} else if _, ok := m.byMqd[mq.mqd]; ok {
+		return nil
+	}
+	if err := unix.EpollCtl(m.epfd, unix.EPOLL_CTL_ADD, mq.mqd, &unix.EpollEvent{Events: unix.EPOLLIN, Fd: int32(mq.mqd)}); err != nil {
+		return err
+	}
+
+	q := &muxQueue{mq: mq, buf: make([]byte, attr.MaxMessageSize)}
+	m.queues = append(m.queues, q)
+	m.byMqd[mq.mqd] = q
+	return nil
+}
+
+// Remove stops receiving from mq. If a message was received from mq but not yet returned by Receive,
+// it is returned as held, otherwise held is nil. The held message keeps its expiry, see [MQ.SendMessage].
+func (m *Mux) Remove(mq *MQ) (held *Message, _ error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrMuxClosed{}
+	}
+	q, ok := m.byMqd[mq.mqd]
+	if !ok {
+		return nil, nil
+	}
+
+	if q.held {
+		held = &q.msg
+	}
+	delete(m.byMqd, mq.mqd)
+	m.queues = slices.DeleteFunc(m.queues, func(mq *muxQueue) bool { return mq == q })
+	m.next = 0
+	return held, unix.EpollCtl(m.epfd, unix.EPOLL_CTL_DEL, mq.mqd, nil)
+}
+
+// Receive returns the next message from whichever queue is ready, following the mux's policy.
+// The returned data is invalid after the next call to Receive.
+// If dl passes before any queue is ready, [ErrSendRecvTimeout] is returned.
+// Messages received with [ErrExpiryMissing] from a strict [OptionExpiry] queue are returned along with it.
+func (m *Mux) Receive(dl deadline.Deadline) (*MQ, []byte, uint, error) {
+	events := make([]unix.EpollEvent, 16)
+	timeout := 0
+	for {
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			return nil, nil, 0, ErrMuxClosed{}
+		}
+		m.waiting++
+		m.mu.Unlock()
+
+		n, err := unix.EpollWait(m.epfd, events, timeout)
+
+		m.mu.Lock()
+		m.waiting--
+		if m.closed {
+			if m.waiting == 0 {
+				err = errors.Join(ErrMuxClosed{}, m.closeFds())
+			} else {
+				err = ErrMuxClosed{}
+			}
+			m.mu.Unlock()
+			return nil, nil, 0, err
+		} else if errors.Is(err, unix.EINTR) {
+			m.mu.Unlock()
+			continue
+		} else if err != nil {
+			m.mu.Unlock()
+			return nil, nil, 0, err
+		}
+		if q, err := m.fill(events[:n]); err != nil {
+			m.mu.Unlock()
+			return q.mq, nil, 0, err
+		}
+		if q := m.pick(); q != nil {
+			err := q.err
+			q.held, q.err = false, nil
+			m.mu.Unlock()
+			return q.mq, q.msg.Data, q.msg.Priority, err
+		}
+		m.mu.Unlock()
+
+		if timeout, err = epollTimeout(dl); err != nil {
+			return nil, nil, 0, err
+		}
+	}
+}
+
+// Close stops the mux and interrupts any blocked Receive. Held messages are discarded.
+func (m *Mux) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+
+	if m.waiting > 0 {
+		// The descriptors are closed by the last interrupted Receive, so they can't be reused while it is waiting.
+		_, err := unix.Write(m.wakefd, []byte{1, 0, 0, 0, 0, 0, 0, 0})
+		return err
+	}
+	return m.closeFds()
+}
+
+func (m *Mux) closeFds() error {
+	return errors.Join(unix.Close(m.epfd), unix.Close(m.wakefd))
+}
+
+// fill receives the head messages of ready queues.
+// With [MuxRoundRobin] only the next ready queue in turn is received from, so no other messages are held.
+func (m *Mux) fill(events []unix.EpollEvent) (*muxQueue, error) {
+	ready := make(map[*muxQueue]bool, len(events))
+	for _, ev := range events {
+		if q, ok := m.byMqd[int(ev.Fd)]; ok {
+			ready[q] = true
+		}
+	}
+
+	for i := range m.queues {
+		q := m.queues[(m.next+i)%len(m.queues)]
+		if !ready[q] || q.held {
+			continue
+		} else if err := q.fill(); err != nil {
+			return q, err
+		} else if q.held && m.policy == MuxRoundRobin {
+			break
+		}
+	}
+	return nil, nil
+}
+
+// fill receives the head message of the queue without blocking.
+func (q *muxQueue) fill() error {
+	msg, err := q.mq.receiveMessageInto(deadline.Past, q.buf)
+	if errors.Is(err, ErrSendRecvTimeout{}) || errors.Is(err, ErrRecvEmptyQueue{}) {
+		// Another reader took the message first.
+		return nil
+	} else if err != nil && !errors.Is(err, ErrExpiryMissing{}) {
+		return err
+	}
+	// A message missing its expiry has already been dequeued, so it is held and returned with the error.
+	q.msg, q.held, q.err = msg, true, err
+	return nil
+}
+
+// pick chooses a held message according to the policy, or returns nil if none are held.
+func (m *Mux) pick() *muxQueue {
+	var best *muxQueue
+	for i := range m.queues {
+		q := m.queues[(m.next+i)%len(m.queues)]
+		if !q.held {
+			continue
+		}
+		if best == nil || (m.policy == MuxPriority && q.msg.Priority > best.msg.Priority) {
+			best = q
+		}
+		if m.policy == MuxRoundRobin {
+			break
+		}
+	}
+	if best != nil {
+		m.next = (slices.Index(m.queues, best) + 1) % len(m.queues)
+	}
+	return best
+}
+
+// epollTimeout converts a deadline to an epoll timeout in milliseconds, -1 meaning no timeout.
+func epollTimeout(dl deadline.Deadline) (int, error) {
+	t, ok := dl.Deadline()
+	if !ok || t.IsZero() {
+		return -1, nil
+	}
+	d := time.Until(t)
+	if d <= 0 {
+		return 0, ErrSendRecvTimeout{}
+	}
+	return int(min(math.Ceil(float64(d)/float64(time.Millisecond)), math.MaxInt32)), nil
+}
@@ -0,0 +1,205 @@
+package posixmq
+
+import (
+	"errors"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"testing"
+	"time"
+)
+
+func newTestMuxQueues(t *testing.T, n int) []*MQ {
+	t.Helper()
+	mqs := make([]*MQ, n)
+	for i := range mqs {
+		mq, err := New(randName(), OptionCreateArgs(0644, 1, 4), OptionOflag(OpenReadWrite))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { mq.Unlink() })
+		mqs[i] = mq
+	}
+	return mqs
+}
+
+func TestMux_Receive(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		policy   MuxPolicy
+		sends    [][2]int // Queue index and priority.
+		expected [][2]int
+	}{
+		{
+			name:     "round robin",
+			policy:   MuxRoundRobin,
+			sends:    [][2]int{{0, 1}, {0, 1}, {1, 9}, {2, 5}},
+			expected: [][2]int{{0, 1}, {1, 9}, {2, 5}, {0, 1}},
+		},
+		{
+			name:     "priority",
+			policy:   MuxPriority,
+			sends:    [][2]int{{0, 1}, {0, 1}, {1, 9}, {2, 5}},
+			expected: [][2]int{{1, 9}, {2, 5}, {0, 1}, {0, 1}},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			mqs := newTestMuxQueues(t, 3)
+			for i, s := range test.sends {
+				if err := mqs[s[0]].Send(t, []byte{byte(i)}, uint(s[1])); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			m, err := NewMux(test.policy, mqs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+
+			for _, e := range test.expected {
+				mq, _, priority, err := m.Receive(t)
+				if err != nil {
+					t.Fatal(err)
+				} else if mq != mqs[e[0]] || priority != uint(e[1]) {
+					t.Fatalf("expected queue %d priority %d, got queue %s priority %d", e[0], e[1], mq.Name(), priority)
+				}
+			}
+
+			_, _, _, err = m.Receive(deadline.TimeDeadline(time.Now().Add(time.Millisecond * 10)))
+			if !errors.Is(err, ErrSendRecvTimeout{}) {
+				t.Fatalf("expected ErrSendRecvTimeout, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMux_Close(t *testing.T) {
+	mqs := newTestMuxQueues(t, 2)
+	m, err := NewMux(MuxPriority, mqs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		_, _, _, err := m.Receive(deadline.NoDeadline{})
+		errc <- err
+	}()
+	time.Sleep(time.Millisecond * 10)
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errc:
+		if !errors.Is(err, ErrMuxClosed{}) {
+			t.Fatalf("expected ErrMuxClosed, got %v", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("receive was not interrupted by close")
+	}
+}
+
+func TestMux_Remove(t *testing.T) {
+	mqs := newTestMuxQueues(t, 2)
+	for i, priority := range []uint{1, 1, 1} {
+		if err := mqs[0].Send(t, []byte{byte(i)}, priority); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mqs[1].Send(t, []byte{9}, 9); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewMux(MuxPriority, mqs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	// Receiving the higher priority message holds the head of the other queue.
+	if mq, data, _, err := m.Receive(t); err != nil {
+		t.Fatal(err)
+	} else if mq != mqs[1] || data[0] != 9 {
+		t.Fatalf("expected message 9 from %s, got %v from %s", mqs[1].Name(), data, mq.Name())
+	}
+	held, err := m.Remove(mqs[0])
+	if err != nil {
+		t.Fatal(err)
+	} else if held == nil || held.Data[0] != 0 {
+		t.Fatalf("expected message 0 to be held, got %v", held)
+	}
+
+	// The rest of the queue is left in order.
+	for _, expected := range []byte{1, 2} {
+		if data, _, err := mqs[0].Receive(t); err != nil {
+			t.Fatal(err)
+		} else if data[0] != expected {
+			t.Fatalf("expected message %d, got %d", expected, data[0])
+		}
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	} else if _, err := m.Remove(mqs[1]); !errors.Is(err, ErrMuxClosed{}) {
+		t.Fatalf("expected ErrMuxClosed, got %v", err)
+	}
+}
+
+func TestMux_ExpiryMissing(t *testing.T) {
+	strict, err := New(randName(), OptionCreateArgs(0644, 32, 4), OptionOflag(OpenReadWrite), OptionExpiry(true, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer strict.Unlink()
+	mqs := append(newTestMuxQueues(t, 1), strict)
+	if err := strict.Send(t, []byte("plain"), 1); err != nil {
+		t.Fatal(err)
+	} else if err := mqs[0].Send(t, []byte{9}, 9); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewMux(MuxPriority, mqs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	// The message without an expiry is held behind the higher priority one, then returned with the error.
+	if mq, data, _, err := m.Receive(t); err != nil {
+		t.Fatal(err)
+	} else if mq != mqs[0] || data[0] != 9 {
+		t.Fatalf("expected message 9 from %s, got %v from %s", mqs[0].Name(), data, mq.Name())
+	}
+	if mq, data, _, err := m.Receive(t); !errors.Is(err, ErrExpiryMissing{}) {
+		t.Fatalf("expected ErrExpiryMissing, got %v", err)
+	} else if mq != strict || string(data) != "plain" {
+		t.Fatalf("expected %q from %s, got %q from %s", "plain", strict.Name(), data, mq.Name())
+	}
+}
+
+func TestSelect(t *testing.T) {
+	mqs := newTestMuxQueues(t, 2)
+	if err := mqs[0].Send(t, []byte{1}, 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range []byte{2, 3} {
+		if err := mqs[1].Send(t, []byte{data}, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mq, data, _, err := Select(t, mqs...)
+	if err != nil {
+		t.Fatal(err)
+	} else if mq != mqs[0] || data[0] != 1 {
+		t.Fatalf("expected message from %s, got %v from %s", mqs[0].Name(), data, mq.Name())
+	}
+
+	// Nothing was taken from the queue that was not selected.
+	for _, expected := range []byte{2, 3} {
+		if data, _, err := mqs[1].Receive(t); err != nil {
+			t.Fatal(err)
+		} else if data[0] != expected {
+			t.Fatalf("expected message %d, got %d", expected, data[0])
+		}
+	}
+}
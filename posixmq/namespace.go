@@ -0,0 +1,217 @@
+package posixmq
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"os"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// mqueueDir is where the mqueue filesystem of the caller's IPC namespace is conventionally mounted.
+const mqueueDir = "/dev/mqueue"
+
+// Namespace is an IPC namespace that queue operations can be performed in.
+// Message queues are isolated per IPC namespace, so a queue name may refer to different queues in different namespaces.
+type Namespace struct {
+	fd    int
+	owned bool
+
+	mu     sync.RWMutex // Held for reading while fd is in use, so it can't be closed underneath.
+	closed bool
+}
+
+// ErrNamespaceClosed is returned when using a [Namespace] that has been closed.
+type ErrNamespaceClosed struct{}
+
+func (ErrNamespaceClosed) Error() string {
+	return "the namespace has been closed"
+}
+
+// OpenNamespace opens the IPC namespace at path, usually /proc/<pid>/ns/ipc.
+func OpenNamespace(path string) (*Namespace, error) {
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open namespace %q: %w", path, err)
+	}
+	return &Namespace{fd: fd, owned: true}, nil
+}
+
+// NamespaceFromFd uses an already open IPC namespace descriptor.
+// The descriptor is not closed by [Namespace.Close].
+func NamespaceFromFd(fd int) *Namespace {
+	return &Namespace{fd: fd}
+}
+
+// Close closes the namespace descriptor if it was opened by [OpenNamespace].
+// Descriptors returned from operations in the namespace remain valid,
+// but further operations on the namespace return [ErrNamespaceClosed].
+func (ns *Namespace) Close() error {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if ns.closed {
+		return nil
+	}
+	ns.closed = true
+	if !ns.owned {
+		return nil
+	}
+	return unix.Close(ns.fd)
+}
+
+// dup returns a namespace with its own descriptor, which stays valid after ns is closed.
+func (ns *Namespace) dup() (*Namespace, error) {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+	if ns.closed {
+		return nil, ErrNamespaceClosed{}
+	}
+	fd, err := unix.FcntlInt(uintptr(ns.fd), unix.F_DUPFD_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to duplicate namespace descriptor: %w", err)
+	}
+	return &Namespace{fd: fd, owned: true}, nil
+}
+
+// Do runs fn on a locked OS thread that has joined the namespace.
+// Message queue descriptors created by fn are usable from any goroutine afterward.
+func (ns *Namespace) Do(fn func() error) error {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+	if ns.closed {
+		return ErrNamespaceClosed{}
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+
+		orig, err := unix.Open("/proc/thread-self/ns/ipc", unix.O_RDONLY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			runtime.UnlockOSThread()
+			errc <- fmt.Errorf("failed to open current namespace: %w", err)
+			return
+		}
+		defer unix.Close(orig)
+
+		if err := unix.Setns(ns.fd, unix.CLONE_NEWIPC); err != nil {
+			runtime.UnlockOSThread()
+			errc <- fmt.Errorf("failed to join namespace: %w", err)
+			return
+		}
+
+		err = fn()
+		if rerr := unix.Setns(orig, unix.CLONE_NEWIPC); rerr != nil {
+			// Leave the thread locked so the runtime terminates it instead of reusing it in the wrong namespace.
+			errc <- errors.Join(err, fmt.Errorf("failed to restore namespace: %w", rerr))
+			return
+		}
+		runtime.UnlockOSThread()
+		errc <- err
+	}()
+	return <-errc
+}
+
+// List returns the names of all queues in the namespace.
+// The mqueue filesystem is mounted in a private mount namespace on a thread that is discarded afterward,
+// which requires CAP_SYS_ADMIN.
+func (ns *Namespace) List() ([]string, error) {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+	if ns.closed {
+		return nil, ErrNamespaceClosed{}
+	}
+
+	dir, err := os.MkdirTemp("", "go-mq-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(dir)
+
+	type result struct {
+		names []string
+		err   error
+	}
+	resc := make(chan result, 1)
+	go func() {
+		// The thread is never unlocked, its mount namespace is changed so it must not be reused.
+		runtime.LockOSThread()
+
+		var res result
+		defer func() { resc <- res }()
+		if res.err = unix.Unshare(unix.CLONE_NEWNS); res.err != nil {
+			res.err = fmt.Errorf("failed to create mount namespace: %w", res.err)
+			return
+		} else if res.err = unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); res.err != nil {
+			res.err = fmt.Errorf("failed to make mounts private: %w", res.err)
+			return
+		} else if res.err = unix.Setns(ns.fd, unix.CLONE_NEWIPC); res.err != nil {
+			res.err = fmt.Errorf("failed to join namespace: %w", res.err)
+			return
+		} else if res.err = unix.Mount("mqueue", dir, "mqueue", 0, ""); res.err != nil {
+			res.err = fmt.Errorf("failed to mount mqueue filesystem: %w", res.err)
+			return
+		}
+		res.names, res.err = listQueues(dir)
+		res.err = errors.Join(res.err, unix.Unmount(dir, unix.MNT_DETACH))
+	}()
+
+	res := <-resc
+	return res.names, res.err
+}
+
+// ListQueues returns the names of all queues in the caller's namespace.
+// The names are read from /dev/mqueue, if it is not mounted the queues are listed using [Namespace.List].
+func ListQueues() ([]string, error) {
+	names, err := listQueues(mqueueDir)
+	if !errors.Is(err, os.ErrNotExist) {
+		return names, err
+	}
+
+	ns, err := OpenNamespace("/proc/thread-self/ns/ipc")
+	if err != nil {
+		return nil, err
+	}
+	defer ns.Close()
+	return ns.List()
+}
+
+// listQueues reads queue names from a mounted mqueue filesystem.
+func listQueues(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, "/"+e.Name())
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+type optionNamespace struct{ ns *Namespace }
+
+// OptionNamespace opens, and later unlinks, the queue inside the IPC namespace ns.
+// The queue keeps its own descriptor of the namespace, so ns may be closed once the queue has been opened.
+// That descriptor is released when the queue is closed, after which [MQ.Unlink] returns [ErrNamespaceClosed]
+// and the queue can only be unlinked with [RawUnlinkNamespace].
+func OptionNamespace(ns *Namespace) MQOption { return optionNamespace{ns: ns} }
+
+func (opt optionNamespace) applyOption(mq *MQ) { mq.ns = opt.ns }
+
+// RawOpenNamespace is [RawOpen] performed inside the IPC namespace ns.
+func RawOpenNamespace(ns *Namespace, name string, oflag OpenFlag, mode int, attr *Attributes) (mqd int, err error) {
+	err = ns.Do(func() (err error) {
+		mqd, err = RawOpen(name, oflag, mode, attr)
+		return err
+	})
+	return mqd, err
+}
+
+// RawUnlinkNamespace is [RawUnlink] performed inside the IPC namespace ns.
+func RawUnlinkNamespace(ns *Namespace, name string) error {
+	return ns.Do(func() error { return RawUnlink(name) })
+}
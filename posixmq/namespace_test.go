@@ -0,0 +1,104 @@
+package posixmq
+
+import (
+	"errors"
+	"golang.org/x/sys/unix"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+// newTestNamespace creates a new IPC namespace on a discarded thread and opens it.
+func newTestNamespace(t *testing.T) *Namespace {
+	t.Helper()
+	type result struct {
+		ns  *Namespace
+		err error
+	}
+	resc := make(chan result, 1)
+	go func() {
+		// Never unlocked, the thread is left in the new namespace.
+		runtime.LockOSThread()
+		if err := unix.Unshare(unix.CLONE_NEWIPC); err != nil {
+			resc <- result{err: err}
+			return
+		}
+		ns, err := OpenNamespace("/proc/thread-self/ns/ipc")
+		resc <- result{ns: ns, err: err}
+	}()
+
+	res := <-resc
+	if errors.Is(res.err, unix.EPERM) {
+		t.Skip("creating an IPC namespace requires CAP_SYS_ADMIN")
+	} else if res.err != nil {
+		t.Fatal(res.err)
+	}
+	t.Cleanup(func() { res.ns.Close() })
+	return res.ns
+}
+
+func TestNamespace(t *testing.T) {
+	ns := newTestNamespace(t)
+	name := randName()
+
+	mq, err := New(name, OptionCreateArgs(0644, 1, 1), OptionOflag(OpenReadWrite), OptionNamespace(ns))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mq.Unlink()
+
+	if _, err := RawOpen(name, OpenReadOnly, 0, nil); !errors.Is(err, ErrOpenNoEntry{}) {
+		t.Fatalf("expected queue to not exist outside the namespace, got %v", err)
+	}
+	if err := mq.Send(t, []byte{1}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := ns.List()
+	if errors.Is(err, unix.EPERM) {
+		t.Skip("listing queues requires CAP_SYS_ADMIN")
+	} else if err != nil {
+		t.Fatal(err)
+	} else if !slices.Contains(names, name) {
+		t.Fatalf("expected %q in %q", name, names)
+	}
+
+	if names, err := ListQueues(); err != nil {
+		t.Fatal(err)
+	} else if slices.Contains(names, name) {
+		t.Fatalf("expected %q to not be listed outside the namespace", name)
+	}
+}
+
+func TestNamespace_Close(t *testing.T) {
+	ns := newTestNamespace(t)
+	other, err := ns.dup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	name := randName()
+
+	mq, err := New(name, OptionCreateArgs(0644, 1, 1), OptionOflag(OpenReadWrite), OptionNamespace(ns))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.Close(); err != nil {
+		t.Fatal(err)
+	} else if err := ns.Do(func() error { return nil }); !errors.Is(err, ErrNamespaceClosed{}) {
+		t.Fatalf("expected ErrNamespaceClosed, got %v", err)
+	}
+
+	// Reuse the closed descriptor number, the queue must still be unlinked in its own namespace.
+	fd, err := unix.Open("/dev/null", unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(fd)
+	if err := mq.Unlink(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RawOpenNamespace(other, name, OpenReadOnly, 0, nil); !errors.Is(err, ErrOpenNoEntry{}) {
+		t.Fatalf("expected queue to be unlinked, got %v", err)
+	}
+}
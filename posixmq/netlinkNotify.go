@@ -0,0 +1,227 @@
+package posixmq
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"os"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+const (
+	notifyCookieLen = 32 // NOTIFY_COOKIE_LEN
+	notifyWokenUp   = 1  // NOTIFY_WOKENUP
+	notifyRemoved   = 2  // NOTIFY_REMOVED
+)
+
+// ErrNotifyRemoved is delivered by a [NetlinkNotifier] when a queue's registration was removed outside the notifier,
+// either by clearing it or by closing the queue.
+type ErrNotifyRemoved struct{}
+
+func (ErrNotifyRemoved) Error() string {
+	return "the notification registration was removed"
+}
+
+// ErrNetlinkNotifierClosed is returned when adding a queue to a [NetlinkNotifier] that has been closed.
+type ErrNetlinkNotifierClosed struct{}
+
+func (ErrNetlinkNotifierClosed) Error() string {
+	return "the netlink notifier has been closed"
+}
+
+// NotifyEvent is a notification delivered by a [NetlinkNotifier].
+type NotifyEvent struct {
+	MQ *MQ
+	// Err is set when the registration was lost, either [ErrNotifyRemoved] or [ErrNotifyBusy] if another process
+	// registered before the notification could be renewed. The channel is closed after an event with an error.
+	Err error
+}
+
+// NetlinkNotifier delivers queue notifications without signals, the way glibc implements SIGEV_THREAD.
+//
+// Queues are registered with [NotifyThread] and a netlink socket. When a notification fires, the kernel
+// writes the registration's cookie to the socket with its last byte set to NOTIFY_WOKENUP, or NOTIFY_REMOVED
+// if the registration was removed. The cookie identifies the queue, so one socket serves every queue.
+// Registrations are renewed after each notification, so every channel keeps receiving events until removed.
+type NetlinkNotifier struct {
+	fd   int // Netlink socket passed to the kernel, owned by f.
+	f    *os.File
+	done chan struct{}
+
+	mu     sync.Mutex
+	byID   map[uint64]*netlinkEntry
+	byMQ   map[*MQ]*netlinkEntry
+	next   uint64
+	closed bool
+}
+
+// netlinkEntry is a queue registered with a NetlinkNotifier.
+type netlinkEntry struct {
+	mq *MQ
+	id uint64
+	c  chan NotifyEvent
+}
+
+// NewNetlinkNotifier creates a netlink notifier.
+func NewNetlinkNotifier() (*NetlinkNotifier, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create netlink socket: %w", err)
+	}
+	n := &NetlinkNotifier{
+		fd:   fd,
+		f:    os.NewFile(uintptr(fd), "mq-notify"),
+		done: make(chan struct{}),
+		byID: map[uint64]*netlinkEntry{},
+		byMQ: map[*MQ]*netlinkEntry{},
+		next: 1,
+	}
+	go n.listen()
+	return n, nil
+}
+
+// Add registers mq for notifications and returns a channel that receives an event each time
+// a message arrives in the empty queue. If mq already has a registration, [ErrNotifyBusy] is returned.
+func (n *NetlinkNotifier) Add(mq *MQ) (<-chan NotifyEvent, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return nil, ErrNetlinkNotifierClosed{}
+	} else if e, ok := n.byMQ[mq]; ok {
+		return e.c, nil
+	}
+
+	e := &netlinkEntry{mq: mq, id: n.next, c: make(chan NotifyEvent, 1)}
+	if err := e.register(n.fd); err != nil {
+		return nil, err
+	}
+	n.next++
+	n.byID[e.id] = e
+	n.byMQ[mq] = e
+	return e.c, nil
+}
+
+// Remove clears the registration for mq and closes its channel.
+func (n *NetlinkNotifier) Remove(mq *MQ) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	e, ok := n.byMQ[mq]
+	if !ok {
+		return nil
+	}
+	n.drop(e)
+	return mq.ClearNotify()
+}
+
+// Close clears all registrations, closes their channels and the netlink socket.
+func (n *NetlinkNotifier) Close() error {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return nil
+	}
+	n.closed = true
+	var err error
+	for mq, e := range n.byMQ {
+		n.drop(e)
+		err = errors.Join(err, mq.ClearNotify())
+	}
+	n.mu.Unlock()
+
+	// Closing the file interrupts the blocked read.
+	err = errors.Join(err, n.f.Close())
+	<-n.done
+	return err
+}
+
+// drop forgets the entry and closes its channel.
+func (n *NetlinkNotifier) drop(e *netlinkEntry) {
+	delete(n.byMQ, e.mq)
+	delete(n.byID, e.id)
+	close(e.c)
+}
+
+// register sets up the netlink notification for the entry.
+// The kernel copies the cookie during the call, so it only has to stay valid until then.
+func (e *netlinkEntry) register(fd int) error {
+	cookie := make([]byte, notifyCookieLen)
+	binary.NativeEndian.PutUint64(cookie, e.id)
+	err := RawNotify(e.mq.mqd, &Notify{
+		Notify: NotifyThread,
+		Signo:  unix.Signal(fd),
+		Value:  uintptr(unsafe.Pointer(&cookie[0])),
+	})
+	runtime.KeepAlive(cookie)
+	return err
+}
+
+// dispatch handles a cookie read from the netlink socket.
+func (n *NetlinkNotifier) dispatch(cookie []byte) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	e, ok := n.byID[binary.NativeEndian.Uint64(cookie)]
+	if !ok {
+		return
+	}
+
+	var err error
+	switch cookie[notifyCookieLen-1] {
+	case notifyWokenUp:
+		// The registration is renewed first so a message arriving after the queue is drained is not missed.
+		if err = e.register(n.fd); err == nil {
+			select {
+			case e.c <- NotifyEvent{MQ: e.mq}:
+			default:
+			}
+			return
+		}
+	case notifyRemoved:
+		err = ErrNotifyRemoved{}
+	default:
+		return
+	}
+
+	// A pending wake up is replaced by the error, which is more important.
+	select {
+	case <-e.c:
+	default:
+	}
+	e.c <- NotifyEvent{MQ: e.mq, Err: err}
+	n.drop(e)
+}
+
+// dispatchLost handles cookies dropped because the socket's receive buffer overflowed.
+// Registrations that are still active return EBUSY, so only queues whose notification fired are renewed.
+func (n *NetlinkNotifier) dispatchLost() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, e := range n.byID {
+		if err := e.register(n.fd); err == nil {
+			select {
+			case e.c <- NotifyEvent{MQ: e.mq}:
+			default:
+			}
+		}
+	}
+}
+
+// listen reads cookies from the netlink socket until it is closed.
+func (n *NetlinkNotifier) listen() {
+	defer close(n.done)
+	buf := make([]byte, notifyCookieLen)
+	for {
+		nn, err := n.f.Read(buf)
+		if errors.Is(err, os.ErrClosed) {
+			return
+		} else if errors.Is(err, unix.ENOBUFS) {
+			n.dispatchLost()
+			continue
+		} else if err != nil || nn != notifyCookieLen {
+			continue
+		}
+		n.dispatch(buf)
+	}
+}
@@ -0,0 +1,94 @@
+package posixmq
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestNetlinkNotifier(t *testing.T) *NetlinkNotifier {
+	t.Helper()
+	n, err := NewNetlinkNotifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { n.Close() })
+	return n
+}
+
+func TestNetlinkNotifier(t *testing.T) {
+	n := newTestNetlinkNotifier(t)
+	mqs := newTestMuxQueues(t, 2)
+	cs := make([]<-chan NotifyEvent, len(mqs))
+	for i, mq := range mqs {
+		var err error
+		if cs[i], err = n.Add(mq); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each round checks the notification is renewed after firing.
+	for round := range 3 {
+		if err := mqs[1].Send(t, []byte{byte(round)}, 0); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case ev := <-cs[1]:
+			if ev.Err != nil {
+				t.Fatalf("round %d: %v", round, ev.Err)
+			} else if ev.MQ != mqs[1] {
+				t.Fatalf("round %d: expected event for %s, got %s", round, mqs[1].Name(), ev.MQ.Name())
+			}
+		case <-cs[0]:
+			t.Fatalf("round %d: notified for the wrong queue", round)
+		case <-time.After(time.Second * 5):
+			t.Fatalf("round %d: notify timeout", round)
+		}
+		if _, _, err := mqs[1].Receive(t); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := n.Remove(mqs[0]); err != nil {
+		t.Fatal(err)
+	} else if _, ok := <-cs[0]; ok {
+		t.Fatal("expected channel to be closed after remove")
+	}
+}
+
+func TestNetlinkNotifier_Removed(t *testing.T) {
+	n := newTestNetlinkNotifier(t)
+	mq := newTestMuxQueues(t, 1)[0]
+	c, err := n.Add(mq)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Clearing the registration outside the notifier makes the kernel send NOTIFY_REMOVED.
+	if err := mq.ClearNotify(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-c:
+		if !errors.Is(ev.Err, ErrNotifyRemoved{}) {
+			t.Fatalf("expected ErrNotifyRemoved, got %v", ev.Err)
+		} else if _, ok := <-c; ok {
+			t.Fatal("expected channel to be closed after the registration was lost")
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("removal was not reported")
+	}
+}
+
+func TestNetlinkNotifier_Busy(t *testing.T) {
+	n := newTestNetlinkNotifier(t)
+	mq := newTestMuxQueues(t, 1)[0]
+	if err := mq.Notify(testNotifySig); err != nil {
+		t.Fatal(err)
+	}
+	defer mq.ClearNotify()
+
+	if _, err := n.Add(mq); !errors.Is(err, ErrNotifyBusy{}) {
+		t.Fatalf("expected ErrNotifyBusy, got %v", err)
+	}
+}
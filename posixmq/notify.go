@@ -13,14 +13,15 @@ import (
 var (
 	NotifyNone   int // Registers a handler but sends no signal
 	NotifySignal int
+	NotifyThread int // Sends a cookie to a netlink socket, see [NetlinkNotifier]
 	//go:embed notifyValues.bin
 	notifyValues []byte
 )
 
 func init() {
 	b := notifyValues
-	for _, p := range []*int{&NotifyNone, &NotifySignal} {
-		nn, n := binary.Uvarint(b)
+	for _, p := range []*int{&NotifyNone, &NotifySignal, &NotifyThread} {
+		nn, n := binary.Varint(b)
 		b = b[n:]
 		*p = int(nn)
 	}
@@ -29,7 +30,19 @@ func init() {
 // Notify defines the structure for queue notification settings.
 type Notify struct {
 	Notify int         `json:"sigev_notify"` // Notification type (e.g., NotifyNone, NotifySignal).
-	Signo  unix.Signal `json:"sigev_signo"`  // Signal number to use for signal-based notifications.
+	Signo  unix.Signal `json:"sigev_signo"`  // Signal number to use for signal-based notifications, or the netlink socket for NotifyThread.
+	Value  uintptr     `json:"sigev_value"`  // Value delivered in siginfo's si_value, or a pointer to the cookie for NotifyThread.
+}
+
+// sigeventSize is the size of the kernel's struct sigevent.
+const sigeventSize = 64
+
+// sigevent is the kernel's struct sigevent, which Notify is converted to.
+type sigevent struct {
+	value  uintptr // sigev_value
+	signo  int32   // sigev_signo
+	notify int32   // sigev_notify
+	_      [sigeventSize - unsafe.Sizeof(uintptr(0)) - 8]byte
 }
 
 type ErrNotifyBusy struct {
@@ -59,6 +72,15 @@ var sysNotify = sys.New(
 )
 
 // RawNotify sets up a notification mechanism for a message queue.
+// If notify is nil, the calling process's registration is removed.
 func RawNotify(mq int, notify *Notify) error {
-	return sysNotify.Call(uintptr(mq), uintptr(unsafe.Pointer(notify)))
+	var sev *sigevent
+	if notify != nil {
+		sev = &sigevent{
+			value:  notify.Value,
+			signo:  int32(notify.Signo),
+			notify: int32(notify.Notify),
+		}
+	}
+	return sysNotify.Call(uintptr(mq), uintptr(unsafe.Pointer(sev)))
 }
@@ -0,0 +1,243 @@
+package posixmq
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// ErrNotifyMuxClosed is returned when adding a queue to a [NotifyMux] that has been closed.
+type ErrNotifyMuxClosed struct{}
+
+func (ErrNotifyMuxClosed) Error() string {
+	return "the notify mux has been closed"
+}
+
+// notifyMuxRearmed is called with each queue whose registration a NotifyMux renews, for tests.
+var notifyMuxRearmed func(*MQ)
+
+// NotifyMux delivers notifications for many queues using a single signal.
+//
+// Each queue is registered with a unique sigev_value. A signalfd on a locked OS thread reads si_value
+// to identify which queue fired, so only that queue is re-armed and woken.
+// Notification signals are sent to the process, so the Go runtime may take one on another thread first,
+// in which case si_value is lost. The queues whose registration fired are then found by reading the status
+// of every queue, which costs a read per queue but leaves the registrations that did not fire alone.
+// Registrations are renewed after each notification, so every channel keeps receiving notifications until removed.
+// A channel is woken even if another process registered for its queue in the meantime, see [MQ.NotifyOwner].
+type NotifyMux struct {
+	sig    unix.Signal
+	sigc   chan os.Signal
+	wakefd int // eventfd used to stop the signalfd listener.
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	byVal  map[uintptr]*notifyEntry
+	byMQ   map[*MQ]*notifyEntry
+	next   uintptr
+	closed bool
+}
+
+// notifyEntry is a queue registered with a NotifyMux.
+type notifyEntry struct {
+	mq    *MQ
+	value uintptr
+	c     chan struct{}
+}
+
+// NewNotifyMux creates a notify mux using sig, usually a real-time signal.
+func NewNotifyMux(sig unix.Signal) (_ *NotifyMux, err error) {
+	n := &NotifyMux{
+		sig:   sig,
+		sigc:  make(chan os.Signal, 1),
+		done:  make(chan struct{}),
+		byVal: map[uintptr]*notifyEntry{},
+		byMQ:  map[*MQ]*notifyEntry{},
+		next:  1,
+	}
+	if n.wakefd, err = unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK); err != nil {
+		return nil, err
+	}
+
+	ready := make(chan error, 1)
+	n.wg.Add(1)
+	go n.listenSignalfd(ready)
+	if err := <-ready; err != nil {
+		return nil, errors.Join(err, unix.Close(n.wakefd))
+	}
+	signal.Notify(n.sigc, sig)
+	n.wg.Add(1)
+	go n.listenRuntime()
+	return n, nil
+}
+
+// Add registers mq for notifications and returns a channel that receives a value each time
+// a message arrives in the empty queue. mq must be opened for reading, so its status can be read without reopening it.
+func (n *NotifyMux) Add(mq *MQ) (<-chan struct{}, error) {
+	if mq.Oflag()&OpenWriteOnly == OpenWriteOnly {
+		return nil, fmt.Errorf("invalid queue %s, it must be opened for reading", mq.Name())
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return nil, ErrNotifyMuxClosed{}
+	} else if e, ok := n.byMQ[mq]; ok {
+		return e.c, nil
+	}
+
+	e := &notifyEntry{mq: mq, value: n.next, c: make(chan struct{}, 1)}
+	if err := e.register(n.sig); err != nil {
+		return nil, err
+	}
+	n.next++
+	n.byVal[e.value] = e
+	n.byMQ[mq] = e
+	return e.c, nil
+}
+
+// Remove clears the registration for mq. Its channel will not receive further notifications.
+func (n *NotifyMux) Remove(mq *MQ) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	e, ok := n.byMQ[mq]
+	if !ok {
+		return nil
+	}
+	delete(n.byMQ, mq)
+	delete(n.byVal, e.value)
+	return mq.ClearNotify()
+}
+
+// Close clears all registrations and stops listening for the signal.
+func (n *NotifyMux) Close() error {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return nil
+	}
+	n.closed = true
+	var err error
+	for mq := range n.byMQ {
+		err = errors.Join(err, mq.ClearNotify())
+	}
+	n.byMQ, n.byVal = nil, nil
+	n.mu.Unlock()
+
+	signal.Stop(n.sigc)
+	close(n.done)
+	_, werr := unix.Write(n.wakefd, []byte{1, 0, 0, 0, 0, 0, 0, 0})
+	n.wg.Wait()
+	return errors.Join(err, werr, unix.Close(n.wakefd))
+}
+
+// register sets up the signal notification for the entry.
+func (e *notifyEntry) register(sig unix.Signal) error {
+	return RawNotify(e.mq.mqd, &Notify{
+		Notify: NotifySignal,
+		Signo:  sig,
+		Value:  e.value,
+	})
+}
+
+// notify renews the registration, which was consumed by the notification, and wakes the channel.
+// The registration is renewed first so a message arriving after the queue is drained is not missed.
+// The channel is woken even if renewing fails, as the notification did fire.
+func (e *notifyEntry) notify(sig unix.Signal) {
+	_ = e.register(sig)
+	if notifyMuxRearmed != nil {
+		notifyMuxRearmed(e.mq)
+	}
+	select {
+	case e.c <- struct{}{}:
+	default:
+	}
+}
+
+// dispatchValue handles a signal whose si_value is known.
+func (n *NotifyMux) dispatchValue(value uintptr) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if e, ok := n.byVal[value]; ok {
+		e.notify(n.sig)
+	}
+}
+
+// dispatchStatus handles a signal whose si_value was lost, by renewing the registrations
+// that are no longer held by this process.
+func (n *NotifyMux) dispatchStatus() {
+	pid := os.Getpid()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, e := range n.byVal {
+		if owner, err := e.mq.NotifyOwner(); err == nil && owner.PID != pid {
+			e.notify(n.sig)
+		}
+	}
+}
+
+// listenRuntime handles signals delivered through the Go runtime.
+func (n *NotifyMux) listenRuntime() {
+	defer n.wg.Done()
+	for {
+		select {
+		case <-n.done:
+			return
+		case <-n.sigc:
+			n.dispatchStatus()
+		}
+	}
+}
+
+// listenSignalfd reads signals with their si_value on a locked thread blocking the signal.
+func (n *NotifyMux) listenSignalfd(ready chan<- error) {
+	defer n.wg.Done()
+	// The thread's signal mask is changed, so it must not be reused.
+	runtime.LockOSThread()
+
+	var set unix.Sigset_t
+	sigsetAdd(&set, n.sig)
+	if err := unix.PthreadSigmask(unix.SIG_BLOCK, &set, nil); err != nil {
+		ready <- fmt.Errorf("failed to block signal: %w", err)
+		return
+	}
+	sfd, err := unix.Signalfd(-1, &set, unix.SFD_CLOEXEC|unix.SFD_NONBLOCK)
+	if err != nil {
+		ready <- fmt.Errorf("failed to create signalfd: %w", err)
+		return
+	}
+	defer unix.Close(sfd)
+	ready <- nil
+
+	var info unix.SignalfdSiginfo
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(&info)), unsafe.Sizeof(info))
+	fds := []unix.PollFd{{Fd: int32(sfd), Events: unix.POLLIN}, {Fd: int32(n.wakefd), Events: unix.POLLIN}}
+	for {
+		if _, err := unix.Poll(fds, -1); err != nil && !errors.Is(err, unix.EINTR) {
+			return
+		} else if fds[1].Revents != 0 {
+			return
+		} else if fds[0].Revents == 0 {
+			continue
+		}
+
+		for {
+			if _, err := unix.Read(sfd, buf); err != nil {
+				break
+			}
+			n.dispatchValue(uintptr(info.Ptr))
+		}
+	}
+}
+
+// sigsetAdd adds sig to set.
+func sigsetAdd(set *unix.Sigset_t, sig unix.Signal) {
+	bits := uint(unsafe.Sizeof(set.Val[0]) * 8)
+	set.Val[uint(sig-1)/bits] |= 1 << (uint(sig-1) % bits)
+}
@@ -0,0 +1,71 @@
+package posixmq
+
+import (
+	"golang.org/x/sys/unix"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testNotifyMuxSig unix.Signal = unix.SIGUSR2
+
+func TestNotifyMux(t *testing.T) {
+	var rearmedMu sync.Mutex
+	rearmed := map[*MQ]int{}
+	notifyMuxRearmed = func(mq *MQ) {
+		rearmedMu.Lock()
+		defer rearmedMu.Unlock()
+		rearmed[mq]++
+	}
+	t.Cleanup(func() { notifyMuxRearmed = nil })
+
+	n, err := NewNotifyMux(testNotifyMuxSig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	mqs := make([]*MQ, 2)
+	cs := make([]<-chan struct{}, len(mqs))
+	for i := range mqs {
+		mq, err := New(randName(), OptionCreateArgs(0644, 1, 1), OptionOflag(OpenReadWrite))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mq.Unlink()
+		mqs[i] = mq
+		if cs[i], err = n.Add(mq); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each round checks the notification is renewed after firing.
+	for round := range 3 {
+		if err := mqs[1].Send(t, []byte{byte(round)}, 0); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-cs[1]:
+		case <-cs[0]:
+			t.Fatalf("round %d: notified for the wrong queue", round)
+		case <-time.After(time.Second * 5):
+			t.Fatalf("round %d: notify timeout", round)
+		}
+		if _, _, err := mqs[1].Receive(t); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case <-cs[0]:
+		t.Fatal("notified for a queue without messages")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	// Only the registration that fired is renewed by each signal, the other is left alone.
+	rearmedMu.Lock()
+	defer rearmedMu.Unlock()
+	if rearmed[mqs[0]] != 0 || rearmed[mqs[1]] != 3 {
+		t.Fatalf("expected only the signalled queue to be re-armed 3 times, got %d and %d", rearmed[mqs[0]], rearmed[mqs[1]])
+	}
+}
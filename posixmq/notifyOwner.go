@@ -0,0 +1,217 @@
+package posixmq
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"golang.org/x/sys/unix"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// notifyRetryInterval is how often a busy registration or lease is retried.
+const notifyRetryInterval = time.Millisecond * 10
+
+// NotifyOwner describes the notification registration of a queue, as reported by the mqueue filesystem.
+type NotifyOwner struct {
+	QSize  uint64      `json:"qsize"`      // Bytes of message data in the queue.
+	Notify int         `json:"notify"`     // sigev_notify of the registration.
+	Signo  unix.Signal `json:"signo"`      // Signal of the registration if it uses NotifySignal.
+	PID    int         `json:"notify_pid"` // Registered process, 0 if none or not visible in the caller's PID namespace.
+}
+
+// Registered reports whether a process visible to the caller is registered.
+func (o NotifyOwner) Registered() bool { return o.PID != 0 }
+
+// Alive reports whether the registered process is still running.
+func (o NotifyOwner) Alive() bool {
+	if o.PID == 0 {
+		return false
+	}
+	err := unix.Kill(o.PID, 0)
+	return err == nil || errors.Is(err, unix.EPERM)
+}
+
+// ErrNotifyOwnerAlive is returned when taking over a registration owned by a process that is still running.
+type ErrNotifyOwnerAlive struct {
+	Owner NotifyOwner
+}
+
+func (err ErrNotifyOwnerAlive) Error() string {
+	return fmt.Sprintf("the notification is registered by process %d which is still running", err.Owner.PID)
+}
+
+// RawNotifyOwner reads the notification registration of a message queue descriptor.
+// The status is read from the descriptor, so the mqueue filesystem does not need to be mounted.
+// Write-only descriptors can't be read, so their status is read by opening the queue again through /proc.
+// Closing that descriptor clears any registration of the calling process, as closing any descriptor of the queue does.
+func RawNotifyOwner(mqd int) (NotifyOwner, error) {
+	// A status line is far shorter than this, see mqueue_read_file in the kernel.
+	b := make([]byte, 128)
+	n, err := unix.Pread(mqd, b, 0)
+	if errors.Is(err, unix.EBADF) {
+		b, err = os.ReadFile(fmt.Sprintf("/proc/self/fd/%d", mqd))
+		n = len(b)
+	}
+	if err != nil {
+		return NotifyOwner{}, err
+	}
+	return parseNotifyOwner(string(b[:n]))
+}
+
+// parseNotifyOwner parses a status line such as "QSIZE:0 NOTIFY:0 SIGNO:10 NOTIFY_PID:1234".
+func parseNotifyOwner(s string) (o NotifyOwner, _ error) {
+	for _, field := range strings.Fields(s) {
+		key, value, ok := strings.Cut(field, ":")
+		if !ok {
+			return NotifyOwner{}, fmt.Errorf("invalid queue status field %q", field)
+		}
+		var err error
+		switch key {
+		case "QSIZE":
+			o.QSize, err = strconv.ParseUint(value, 10, 64)
+		case "NOTIFY":
+			o.Notify, err = strconv.Atoi(value)
+		case "SIGNO":
+			var signo int
+			signo, err = strconv.Atoi(value)
+			o.Signo = unix.Signal(signo)
+		case "NOTIFY_PID":
+			o.PID, err = strconv.Atoi(value)
+		}
+		if err != nil {
+			return NotifyOwner{}, fmt.Errorf("invalid queue status field %q: %w", field, err)
+		}
+	}
+	return o, nil
+}
+
+// NotifyOwner reads the notification registration of the queue.
+func (mq *MQ) NotifyOwner() (NotifyOwner, error) {
+	return RawNotifyOwner(mq.mqd)
+}
+
+// TakeoverOption represents options that can be applied when taking over a notification registration.
+type TakeoverOption interface {
+	applyTakeoverOption(*takeoverConfig)
+}
+
+type takeoverConfig struct {
+	probe bool
+}
+
+type takeoverProbe struct{}
+
+// TakeoverProbe fires a registration that is not released by sending a zero-length message at [MaxPriority]
+// to the queue while it is empty, which needs [OpenReadWrite]. The probe is received again straight away,
+// but a consumer receiving at the same time may still see it, so consumers must ignore empty messages.
+func TakeoverProbe() TakeoverOption { return takeoverProbe{} }
+
+func (takeoverProbe) applyTakeoverOption(c *takeoverConfig) { c.probe = true }
+
+// TakeoverNotify registers notify for the queue, taking over the registration if its owner is no longer running.
+//
+// The kernel only lets the owner clear a registration, so registering is retried until the owner releases it,
+// which happens when it exits or closes the queue. The queue is left untouched unless [TakeoverProbe] is passed.
+// If the owner is running, [ErrNotifyOwnerAlive] is returned unless force is set.
+// Owners that are not visible in the caller's PID namespace are treated as running.
+// Registrations are retried until dl passes, returning [ErrSendRecvTimeout].
+func (mq *MQ) TakeoverNotify(dl deadline.Deadline, notify *Notify, force bool, opts ...TakeoverOption) error {
+	var c takeoverConfig
+	for _, opt := range opts {
+		opt.applyTakeoverOption(&c)
+	}
+
+	for {
+		if err := RawNotify(mq.mqd, notify); !errors.Is(err, ErrNotifyBusy{}) {
+			return err
+		}
+
+		owner, err := mq.NotifyOwner()
+		if err != nil {
+			return err
+		} else if !force && (owner.PID == 0 || owner.Alive()) {
+			return ErrNotifyOwnerAlive{Owner: owner}
+		}
+
+		if c.probe {
+			if err := mq.probe(); err != nil {
+				return err
+			}
+		}
+		if !deadline.Sleep(dl, notifyRetryInterval) {
+			return ErrSendRecvTimeout{}
+		}
+	}
+}
+
+// probe sends an empty message to fire the registration of the queue, then receives it again.
+// A registration only fires when a message arrives in an empty queue, so a non-empty queue is not probed.
+func (mq *MQ) probe() error {
+	attr, err := mq.GetAttr()
+	if err != nil {
+		return err
+	} else if attr.NumCurrMessages != 0 {
+		return nil
+	}
+
+	// Sending fires the registration before returning.
+	if _, err := RawSendReceive(mq.mqd, deadline.Past, nil, uint(MaxPriority)); errors.Is(err, ErrSendRecvTimeout{}) || errors.Is(err, ErrSendFullQueue{}) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to send probe message: %w", err)
+	}
+
+	// The probe has the highest priority and the queue was empty, so it is received first unless another reader took it.
+	buf := make([]byte, attr.MaxMessageSize)
+	var priority uint
+	n, err := RawSendReceive(mq.mqd, deadline.Past, buf, &priority)
+	if errors.Is(err, ErrSendRecvTimeout{}) || errors.Is(err, ErrRecvEmptyQueue{}) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to remove probe message: %w", err)
+	} else if n != 0 || priority != MaxPriority {
+		// Another reader took the probe, so this message arrived after it and is sent back.
+		if _, err := RawSendReceive(mq.mqd, deadline.Past, buf[:n], priority); err != nil {
+			return fmt.Errorf("failed to send back message received instead of the probe: %w", err)
+		}
+	}
+	return nil
+}
+
+// NotifyLease lets consumers of a queue take turns being registered for notification.
+//
+// The lease is an exclusive flock on the queue's open file description, so each consumer must open the queue itself.
+// If the holder exits, the kernel releases both the lock and the registration, so a crashed consumer
+// never blocks the others. Messages may arrive while no one is registered, so a new holder should drain the queue
+// after acquiring the lease.
+type NotifyLease struct {
+	mq *MQ
+}
+
+// AcquireNotifyLease waits until no other consumer holds the lease, then registers notify for the queue.
+// If dl passes first, [ErrSendRecvTimeout] is returned.
+func (mq *MQ) AcquireNotifyLease(dl deadline.Deadline, notify *Notify) (*NotifyLease, error) {
+	for {
+		err := unix.Flock(mq.mqd, unix.LOCK_EX|unix.LOCK_NB)
+		if err == nil {
+			break
+		} else if !errors.Is(err, unix.EWOULDBLOCK) && !errors.Is(err, unix.EINTR) {
+			return nil, fmt.Errorf("failed to lock queue: %w", err)
+		} else if !deadline.Sleep(dl, notifyRetryInterval) {
+			return nil, ErrSendRecvTimeout{}
+		}
+	}
+
+	if err := RawNotify(mq.mqd, notify); err != nil {
+		return nil, errors.Join(err, unix.Flock(mq.mqd, unix.LOCK_UN))
+	}
+	return &NotifyLease{mq: mq}, nil
+}
+
+// Release clears the registration and lets the next consumer acquire the lease.
+func (l *NotifyLease) Release() error {
+	return errors.Join(l.mq.ClearNotify(), unix.Flock(l.mq.mqd, unix.LOCK_UN))
+}
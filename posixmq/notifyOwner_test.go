@@ -0,0 +1,140 @@
+package posixmq
+
+import (
+	"errors"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseNotifyOwner(t *testing.T) {
+	owner, err := parseNotifyOwner("QSIZE:12         NOTIFY:0     SIGNO:10    NOTIFY_PID:1234  \n")
+	if err != nil {
+		t.Fatal(err)
+	} else if owner != (NotifyOwner{QSize: 12, Notify: 0, Signo: 10, PID: 1234}) {
+		t.Fatalf("unexpected owner %+v", owner)
+	}
+
+	if _, err := parseNotifyOwner("QSIZE:x"); err == nil {
+		t.Fatal("expected error for invalid field")
+	}
+}
+
+func TestMQ_NotifyOwner(t *testing.T) {
+	mq := newTestMuxQueues(t, 1)[0]
+	if owner, err := mq.NotifyOwner(); err != nil {
+		t.Fatal(err)
+	} else if owner.Registered() {
+		t.Fatalf("expected no owner, got %+v", owner)
+	}
+
+	if err := RawNotify(mq.mqd, &Notify{Notify: NotifyNone}); err != nil {
+		t.Fatal(err)
+	}
+	if owner, err := mq.NotifyOwner(); err != nil {
+		t.Fatal(err)
+	} else if owner.PID != os.Getpid() || !owner.Alive() {
+		t.Fatalf("expected owner %d to be alive, got %+v", os.Getpid(), owner)
+	}
+
+	// Reading the owner leaves the registration in place.
+	if owner, err := mq.NotifyOwner(); err != nil {
+		t.Fatal(err)
+	} else if owner.PID != os.Getpid() {
+		t.Fatalf("expected the registration to be kept, got %+v", owner)
+	}
+}
+
+func TestMQ_TakeoverNotify(t *testing.T) {
+	mq := newTestMuxQueues(t, 1)[0]
+	for i, priority := range []uint{1, 3, 1} {
+		if err := mq.Send(t, []byte{byte(i)}, priority); err != nil {
+			t.Fatal(err)
+		}
+	}
+	notify := &Notify{Notify: NotifyNone}
+	if err := RawNotify(mq.mqd, notify); err != nil {
+		t.Fatal(err)
+	}
+
+	dl := deadline.TimeDeadline(time.Now().Add(time.Second * 5))
+	var alive ErrNotifyOwnerAlive
+	if err := mq.TakeoverNotify(dl, notify, false); !errors.As(err, &alive) || alive.Owner.PID != os.Getpid() {
+		t.Fatalf("expected ErrNotifyOwnerAlive, got %v", err)
+	}
+
+	// The registration is released while the takeover is waiting.
+	time.AfterFunc(time.Millisecond*20, func() { mq.ClearNotify() })
+	if err := mq.TakeoverNotify(dl, notify, true); err != nil {
+		t.Fatal(err)
+	}
+	if owner, err := mq.NotifyOwner(); err != nil {
+		t.Fatal(err)
+	} else if owner.PID != os.Getpid() {
+		t.Fatalf("expected registration after takeover, got %+v", owner)
+	}
+
+	// The messages already in the queue are untouched.
+	for _, expected := range []byte{1, 0, 2} {
+		if data, _, err := mq.Receive(t); err != nil {
+			t.Fatal(err)
+		} else if len(data) != 1 || data[0] != expected {
+			t.Fatalf("expected message %d, got %v", expected, data)
+		}
+	}
+}
+
+func TestMQ_TakeoverNotifyProbe(t *testing.T) {
+	mq := newTestMuxQueues(t, 1)[0]
+	notify := &Notify{Notify: NotifyNone}
+	if err := RawNotify(mq.mqd, notify); err != nil {
+		t.Fatal(err)
+	}
+
+	dl := deadline.TimeDeadline(time.Now().Add(time.Second * 5))
+	if err := mq.TakeoverNotify(dl, notify, true, TakeoverProbe()); err != nil {
+		t.Fatal(err)
+	}
+	if owner, err := mq.NotifyOwner(); err != nil {
+		t.Fatal(err)
+	} else if owner.PID != os.Getpid() {
+		t.Fatalf("expected registration after takeover, got %+v", owner)
+	}
+
+	// The probe is removed again.
+	if attr, err := mq.GetAttr(); err != nil {
+		t.Fatal(err)
+	} else if attr.NumCurrMessages != 0 {
+		t.Fatalf("expected the probe to be removed, got %d messages", attr.NumCurrMessages)
+	}
+}
+
+func TestMQ_AcquireNotifyLease(t *testing.T) {
+	a := newTestMuxQueues(t, 1)[0]
+	b, err := New(a.Name(), OptionOflag(OpenReadWrite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	notify := &Notify{Notify: NotifyNone}
+	la, err := a.AcquireNotifyLease(t, notify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.AcquireNotifyLease(deadline.TimeDeadline(time.Now().Add(time.Millisecond*50)), notify); !errors.Is(err, ErrSendRecvTimeout{}) {
+		t.Fatalf("expected ErrSendRecvTimeout while the lease is held, got %v", err)
+	}
+
+	if err := la.Release(); err != nil {
+		t.Fatal(err)
+	}
+	lb, err := b.AcquireNotifyLease(t, notify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lb.Release(); err != nil {
+		t.Fatal(err)
+	}
+}
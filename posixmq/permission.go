@@ -0,0 +1,117 @@
+package posixmq
+
+import (
+	"github.com/bobcatalyst/go-mq/internal/sys"
+	"golang.org/x/sys/unix"
+	"time"
+	"unsafe"
+)
+
+// Stat contains the ownership and metadata of a message queue.
+type Stat struct {
+	UID   int       `json:"uid"`   // Owner user ID.
+	GID   int       `json:"gid"`   // Owner group ID.
+	Mode  int       `json:"mode"`  // Permission bits.
+	Inode uint64    `json:"inode"` // Inode of the queue in the mqueue filesystem, changes when a queue is recreated.
+	Dev   uint64    `json:"dev"`   // Device of the mqueue filesystem, differs between IPC namespaces.
+	Atime time.Time `json:"atime"` // Last time a message was received.
+	Mtime time.Time `json:"mtime"` // Last time a message was sent.
+	Ctime time.Time `json:"ctime"` // Last time the queue or its metadata changed.
+}
+
+type ErrChmodNoPermission struct {
+	sys.Err[ErrChmodNoPermission]
+}
+
+func (ErrChmodNoPermission) Errno() unix.Errno { return unix.EPERM }
+func (ErrChmodNoPermission) Error() string {
+	return "the caller is not the owner of the queue and does not have CAP_FOWNER"
+}
+
+type ErrChownNoPermission struct {
+	sys.Err[ErrChownNoPermission]
+}
+
+func (ErrChownNoPermission) Errno() unix.Errno { return unix.EPERM }
+func (ErrChownNoPermission) Error() string {
+	return "the caller does not have permission to change the owner or group of the queue"
+}
+
+type ErrChownInvalid struct {
+	sys.Err[ErrChownInvalid]
+}
+
+func (ErrChownInvalid) Errno() unix.Errno { return unix.EINVAL }
+func (ErrChownInvalid) Error() string {
+	return "the owner or group is not valid in the caller's user namespace"
+}
+
+var (
+	sysFstat = sys.New(
+		unix.SYS_FSTAT, 2,
+		ErrBadFileDescriptor{},
+		ErrNoMemory{},
+	)
+	sysFchmod = sys.New(
+		unix.SYS_FCHMOD, 2,
+		ErrBadFileDescriptor{},
+		ErrChmodNoPermission{},
+	)
+	sysFchown = sys.New(
+		unix.SYS_FCHOWN, 3,
+		ErrBadFileDescriptor{},
+		ErrChownNoPermission{},
+		ErrChownInvalid{},
+	)
+)
+
+// RawStat gets the ownership and metadata of a message queue descriptor.
+func RawStat(mqd int) (Stat, error) {
+	var st unix.Stat_t
+	if err := sysFstat.Call(uintptr(mqd), uintptr(unsafe.Pointer(&st))); err != nil {
+		return Stat{}, err
+	}
+	return Stat{
+		UID:   int(st.Uid),
+		GID:   int(st.Gid),
+		Mode:  int(st.Mode & 0o7777),
+		Inode: st.Ino,
+		Dev:   st.Dev,
+		Atime: time.Unix(st.Atim.Unix()),
+		Mtime: time.Unix(st.Mtim.Unix()),
+		Ctime: time.Unix(st.Ctim.Unix()),
+	}, nil
+}
+
+// RawChmod changes the permission bits of a message queue descriptor.
+func RawChmod(mqd int, mode int) error {
+	return sysFchmod.Call(uintptr(mqd), uintptr(mode))
+}
+
+// RawChown changes the owner and group of a message queue descriptor. An ID of -1 leaves it unchanged.
+func RawChown(mqd int, uid, gid int) error {
+	return sysFchown.Call(uintptr(mqd), uintptr(uid), uintptr(gid))
+}
+
+// Stat gets the ownership and metadata of the queue.
+func (mq *MQ) Stat() (Stat, error) {
+	return RawStat(mq.mqd)
+}
+
+// Chmod changes the permission bits of the queue.
+func (mq *MQ) Chmod(mode int) error {
+	return RawChmod(mq.mqd, mode)
+}
+
+// Chown changes the owner and group of the queue. An ID of -1 leaves it unchanged.
+func (mq *MQ) Chown(uid, gid int) error {
+	return RawChown(mq.mqd, uid, gid)
+}
+
+type optionExactMode struct{}
+
+// OptionExactMode applies the create mode exactly, ignoring the process umask.
+// The mode is only applied if the queue is newly created, an existing queue keeps its mode.
+func OptionExactMode() MQOption { return optionExactMode{} }
+
+func (optionExactMode) applyOption(mq *MQ) { mq.exactMode = true }
@@ -0,0 +1,48 @@
+package posixmq
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestMQ_Stat(t *testing.T) {
+	old := syscall.Umask(0o022)
+	defer syscall.Umask(old)
+
+	for _, test := range []struct {
+		name     string
+		opts     []MQOption
+		expected int
+	}{
+		{name: "umask", expected: 0o644},
+		{name: "exact mode", opts: []MQOption{OptionExactMode()}, expected: 0o666},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			mq, err := New(randName(), append(test.opts, OptionCreateArgs(0o666, 1, 1))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mq.Unlink()
+
+			st, err := mq.Stat()
+			if err != nil {
+				t.Fatal(err)
+			} else if st.Mode != test.expected {
+				t.Fatalf("expected mode %#o, got %#o", test.expected, st.Mode)
+			} else if st.UID != os.Geteuid() || st.GID != os.Getegid() {
+				t.Fatalf("expected owner %d:%d, got %d:%d", os.Geteuid(), os.Getegid(), st.UID, st.GID)
+			}
+
+			if err := mq.Chmod(0o600); err != nil {
+				t.Fatal(err)
+			} else if err := mq.Chown(-1, -1); err != nil {
+				t.Fatal(err)
+			} else if st, err := mq.Stat(); err != nil {
+				t.Fatal(err)
+			} else if st.Mode != 0o600 {
+				t.Fatalf("expected mode %#o after chmod, got %#o", 0o600, st.Mode)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package posixmq
+
+import (
+	"fmt"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when a send could not acquire enough budget from a [Limiter] before its deadline.
+// It unwraps to [ErrSendRecvTimeout] so it can be handled the same as a queue timeout.
+type ErrRateLimited struct {
+	// Wait is how long the send would have needed to wait for the budget.
+	Wait time.Duration
+}
+
+func (ErrRateLimited) Unwrap() error { return ErrSendRecvTimeout{} }
+func (err ErrRateLimited) Error() string {
+	return fmt.Sprintf("the rate limit would be exceeded before the deadline, needed to wait %s", err.Wait)
+}
+
+// Limiter is a token bucket limiting the number of messages and bytes sent per second.
+// A Limiter is safe for concurrent use, so it can be shared between producers.
+type Limiter struct {
+	mu    sync.Mutex
+	msgs  bucket
+	bytes bucket
+}
+
+// bucket is a single token bucket. A rate of 0 means unlimited.
+type bucket struct {
+	rate   float64   // Tokens added per second.
+	burst  float64   // Maximum number of tokens held.
+	tokens float64   // Current number of tokens, negative when reserved ahead.
+	last   time.Time // When tokens was last updated.
+}
+
+// NewLimiter creates a limiter allowing messagesPerSecond and bytesPerSecond.
+// Either limit can be 0 to disable it, negative and non-finite limits are rejected.
+// Bursts of up to one second worth of budget are allowed.
+func NewLimiter(messagesPerSecond, bytesPerSecond float64) (*Limiter, error) {
+	for _, rate := range []float64{messagesPerSecond, bytesPerSecond} {
+		if rate < 0 || math.IsNaN(rate) || math.IsInf(rate, 0) {
+			return nil, fmt.Errorf("invalid rate limit %g, it must be 0 or a positive number", rate)
+		}
+	}
+	now := time.Now()
+	return &Limiter{
+		msgs:  bucket{rate: messagesPerSecond, burst: max(messagesPerSecond, 1), tokens: max(messagesPerSecond, 1), last: now},
+		bytes: bucket{rate: bytesPerSecond, burst: bytesPerSecond, tokens: bytesPerSecond, last: now},
+	}, nil
+}
+
+// sharedLimiter is a limiter in sharedLimiters and the number of holders not yet released.
+type sharedLimiter struct {
+	l    *Limiter
+	refs int
+}
+
+var (
+	sharedLimitersMu sync.Mutex
+	sharedLimiters   = map[string]*sharedLimiter{}
+)
+
+// SharedLimiter returns the process wide limiter for the queue name, creating it with the given limits if needed.
+// The limits are ignored if the limiter already exists.
+// Call release once the limiter is no longer used, the limiter is forgotten when the last holder releases it.
+func SharedLimiter(name string, messagesPerSecond, bytesPerSecond float64) (_ *Limiter, release func(), _ error) {
+	sharedLimitersMu.Lock()
+	defer sharedLimitersMu.Unlock()
+	e, ok := sharedLimiters[name]
+	if !ok {
+		l, err := NewLimiter(messagesPerSecond, bytesPerSecond)
+		if err != nil {
+			return nil, nil, err
+		}
+		e = &sharedLimiter{l: l}
+		sharedLimiters[name] = e
+	}
+	e.refs++
+
+	var once sync.Once
+	return e.l, func() {
+		once.Do(func() {
+			sharedLimitersMu.Lock()
+			defer sharedLimitersMu.Unlock()
+			if e.refs--; e.refs == 0 {
+				delete(sharedLimiters, name)
+			}
+		})
+	}, nil
+}
+
+// Wait blocks until a message of size bytes can be sent.
+// If the budget would not be available before dl, no budget is used and [ErrRateLimited] is returned immediately.
+func (l *Limiter) Wait(dl deadline.Deadline, size int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.msgs.refill(now)
+	l.bytes.refill(now)
+
+	wait := max(l.msgs.wait(1), l.bytes.wait(float64(size)))
+	if t, ok := dl.Deadline(); ok && !t.IsZero() && now.Add(wait).After(t) {
+		l.mu.Unlock()
+		return ErrRateLimited{Wait: wait}
+	}
+	l.msgs.take(1)
+	l.bytes.take(float64(size))
+	l.mu.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+	return nil
+}
+
+// refill adds the tokens accumulated since the last update.
+func (b *bucket) refill(now time.Time) {
+	if b.rate == 0 {
+		return
+	}
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// wait returns how long until n tokens are available.
+// Requests larger than the burst only wait for a full bucket so they can eventually succeed.
+func (b *bucket) wait(n float64) time.Duration {
+	if b.rate == 0 {
+		return 0
+	}
+	need := min(n, b.burst) - b.tokens
+	if need <= 0 {
+		return 0
+	}
+	return time.Duration(need / b.rate * float64(time.Second))
+}
+
+// take removes n tokens, which may leave the bucket negative until it refills.
+func (b *bucket) take(n float64) {
+	if b.rate != 0 {
+		b.tokens -= n
+	}
+}
+
+// LimitedMQ wraps an [MQ] so that sends are limited by a [Limiter].
+type LimitedMQ struct {
+	*MQ
+	limiter *Limiter
+}
+
+// NewLimitedMQ wraps mq so every send waits on limiter.
+// Use [SharedLimiter] so that all producers of a queue in the process share one budget.
+func NewLimitedMQ(mq *MQ, limiter *Limiter) *LimitedMQ {
+	return &LimitedMQ{MQ: mq, limiter: limiter}
+}
+
+// Limiter returns the limiter used by the queue.
+func (mq *LimitedMQ) Limiter() *Limiter {
+	return mq.limiter
+}
+
+// Send waits for budget from the limiter and sends a message to the queue.
+// Time spent waiting for budget counts towards dl.
+func (mq *LimitedMQ) Send(dl deadline.Deadline, data []byte, priority uint, opts ...SendOption) error {
+	if err := mq.limiter.Wait(dl, len(data)); err != nil {
+		return err
+	}
+	return mq.MQ.Send(dl, data, priority, opts...)
+}
@@ -0,0 +1,81 @@
+package posixmq
+
+import (
+	"errors"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLimitedMQ_Send(t *testing.T) {
+	mq, err := New(randName(), OptionCreateArgs(0644, 8, 8), OptionOflag(OpenReadWrite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mq.Unlink()
+
+	limiter, err := NewLimiter(2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lmq := NewLimitedMQ(mq, limiter)
+	for range 2 {
+		if err := lmq.Send(t, []byte{1}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = lmq.Send(deadline.TimeDeadline(time.Now().Add(time.Millisecond*10)), []byte{1}, 0)
+	if !errors.Is(err, ErrSendRecvTimeout{}) {
+		t.Fatalf("expected ErrSendRecvTimeout, got %v", err)
+	} else if !errors.As(err, new(ErrRateLimited)) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+
+	start := time.Now()
+	if err := lmq.Send(deadline.TimeDeadline(time.Now().Add(time.Second)), []byte{1}, 0); err != nil {
+		t.Fatal(err)
+	} else if elapsed := time.Since(start); elapsed < time.Millisecond*100 {
+		t.Fatalf("expected send to wait for budget, took %s", elapsed)
+	}
+}
+
+func TestSharedLimiter(t *testing.T) {
+	name := randName()
+	first, release1, err := SharedLimiter(name, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, release2, err := SharedLimiter(name, 5, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if first != second {
+		t.Fatal("expected the same limiter for the same queue name")
+	}
+
+	// The limiter is kept until its last holder releases it, releasing twice has no effect.
+	release1()
+	release1()
+	sharedLimitersMu.Lock()
+	_, ok := sharedLimiters[name]
+	sharedLimitersMu.Unlock()
+	if !ok {
+		t.Fatal("expected the limiter to be kept while held")
+	}
+	release2()
+	sharedLimitersMu.Lock()
+	_, ok = sharedLimiters[name]
+	sharedLimitersMu.Unlock()
+	if ok {
+		t.Fatal("expected the limiter to be forgotten after the last release")
+	}
+}
+
+func TestNewLimiter_Invalid(t *testing.T) {
+	for _, rates := range [][2]float64{{-1, 0}, {0, -1}, {math.NaN(), 0}, {0, math.Inf(1)}} {
+		if _, err := NewLimiter(rates[0], rates[1]); err == nil {
+			t.Fatalf("expected an error for rates %v", rates)
+		}
+	}
+}
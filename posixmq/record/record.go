@@ -0,0 +1,224 @@
+// Package record captures queue traffic to files and replays it, to reproduce incidents and load-test consumers.
+//
+// Messages are captured by a [Recorder] consuming from a queue, or a [Tee] recording each message it sends.
+// A [Writer] can also be the sink of a [posixmq.Mirror], to record live traffic without consuming it.
+// [Replay] sends a recording to a queue at the original pace, scaled, or as fast as possible.
+//
+// A recording starts with the magic "MQRC" and a version byte, followed by records of:
+//
+//	varint  nanoseconds since the previous record, or since the Unix epoch for the first record
+//	uvarint index of the queue name, an index one past the last known name introduces a new name:
+//	        uvarint length, name
+//	uvarint priority
+//	uvarint length, data
+package record
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/posixmq"
+	"io"
+	"sync"
+	"time"
+)
+
+// Version is the format version written by a [Writer].
+const Version = 1
+
+var magic = [4]byte{'M', 'Q', 'R', 'C'}
+
+const (
+	maxNameSize = 255              // NAME_MAX, the longest queue name.
+	maxDataSize = 16 * 1024 * 1024 // The kernel's hard limit on message size.
+)
+
+// Record is a message captured from a queue.
+type Record struct {
+	Time     time.Time
+	Queue    string // Name of the queue.
+	Priority uint
+	Data     []byte // The message as stored in the queue, including any expiry header, see [posixmq.Message.Raw].
+}
+
+// ErrFormat is returned when reading something that is not a valid recording.
+type ErrFormat struct {
+	Reason string
+}
+
+func (err ErrFormat) Error() string {
+	return "invalid recording: " + err.Reason
+}
+
+// ErrVersion is returned when reading a recording of a format version this package does not know.
+type ErrVersion struct {
+	Version byte
+}
+
+func (err ErrVersion) Error() string {
+	return fmt.Sprintf("unsupported recording version %d, expected %d", err.Version, Version)
+}
+
+// Writer encodes records. It is safe for concurrent use.
+// Records are buffered, call [Writer.Flush] to write them out.
+type Writer struct {
+	mu      sync.Mutex
+	w       *bufio.Writer
+	started bool // The header has been written.
+	last    time.Time
+	names   map[string]uint64
+	scratch []byte
+}
+
+// NewWriter creates a writer of a recording to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w), last: time.Unix(0, 0), names: map[string]uint64{}}
+}
+
+// Write encodes a record.
+func (w *Writer) Write(rec Record) error {
+	if len(rec.Queue) > maxNameSize {
+		return fmt.Errorf("queue name of %d bytes is too long", len(rec.Queue))
+	} else if len(rec.Data) > maxDataSize {
+		return fmt.Errorf("message of %d bytes is too large", len(rec.Data))
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	b := binary.AppendVarint(w.scratch[:0], rec.Time.Sub(w.last).Nanoseconds())
+	if idx, ok := w.names[rec.Queue]; ok {
+		b = binary.AppendUvarint(b, idx)
+	} else {
+		idx = uint64(len(w.names))
+		w.names[rec.Queue] = idx
+		b = binary.AppendUvarint(b, idx)
+		b = binary.AppendUvarint(b, uint64(len(rec.Queue)))
+		b = append(b, rec.Queue...)
+	}
+	b = binary.AppendUvarint(b, uint64(rec.Priority))
+	b = binary.AppendUvarint(b, uint64(len(rec.Data)))
+	w.scratch = b
+	w.last = rec.Time
+
+	if _, err := w.w.Write(b); err != nil {
+		return err
+	}
+	_, err := w.w.Write(rec.Data)
+	return err
+}
+
+// Mirror records a message copied by a [posixmq.Mirror], so a Writer can be used as its sink.
+// The record is buffered, flush the Writer to write it out. Records are written synchronously when the buffer fills,
+// so the mirrored queue waits for the file.
+func (w *Writer) Mirror(m posixmq.MirroredMessage) error {
+	raw := posixmq.Message{Data: m.Data, Priority: m.Priority, ExpiresAt: m.ExpiresAt}.Raw()
+	return w.Write(Record{Time: m.Time, Queue: m.Queue, Priority: m.Priority, Data: raw})
+}
+
+// Flush writes buffered records to the underlying writer. An empty recording is written as just the header.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.start(); err != nil {
+		return err
+	}
+	return w.w.Flush()
+}
+
+// start writes the header if it has not been written. Must be called with mu held.
+func (w *Writer) start() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+	_, err := w.w.Write(append(magic[:], Version))
+	return err
+}
+
+// Reader decodes records.
+type Reader struct {
+	r     *bufio.Reader
+	last  time.Time
+	names []string
+}
+
+// NewReader reads the header of a recording from r.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	var header [len(magic) + 1]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrFormat{Reason: "missing header"}
+		}
+		return nil, err
+	} else if [len(magic)]byte(header[:len(magic)]) != magic {
+		return nil, ErrFormat{Reason: "bad magic"}
+	} else if v := header[len(magic)]; v != Version {
+		return nil, ErrVersion{Version: v}
+	}
+	return &Reader{r: br, last: time.Unix(0, 0)}, nil
+}
+
+// Next decodes the next record, returning [io.EOF] at the end of the recording.
+func (r *Reader) Next() (Record, error) {
+	delta, err := binary.ReadVarint(r.r)
+	if errors.Is(err, io.EOF) {
+		return Record{}, io.EOF
+	} else if err != nil {
+		return Record{}, r.truncated(err)
+	}
+	rec := Record{Time: r.last.Add(time.Duration(delta))}
+
+	idx, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return Record{}, r.truncated(err)
+	} else if idx == uint64(len(r.names)) {
+		name, err := r.bytes(maxNameSize)
+		if err != nil {
+			return Record{}, err
+		}
+		r.names = append(r.names, string(name))
+	} else if idx > uint64(len(r.names)) {
+		return Record{}, ErrFormat{Reason: fmt.Sprintf("unknown queue name index %d", idx)}
+	}
+	rec.Queue = r.names[idx]
+
+	priority, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return Record{}, r.truncated(err)
+	}
+	rec.Priority = uint(priority)
+	if rec.Data, err = r.bytes(maxDataSize); err != nil {
+		return Record{}, err
+	}
+	r.last = rec.Time
+	return rec, nil
+}
+
+// bytes reads a length prefixed byte string of at most limit bytes.
+func (r *Reader) bytes(limit uint64) ([]byte, error) {
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, r.truncated(err)
+	} else if n > limit {
+		return nil, ErrFormat{Reason: fmt.Sprintf("length %d exceeds the limit of %d", n, limit)}
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return nil, r.truncated(err)
+	}
+	return b, nil
+}
+
+// truncated reports an EOF in the middle of a record as a format error.
+func (r *Reader) truncated(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrFormat{Reason: "truncated record"}
+	}
+	return err
+}
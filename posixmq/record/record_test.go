@@ -0,0 +1,242 @@
+package record
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/posixmq"
+	"io"
+	"math/rand/v2"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestMQ(t *testing.T) *posixmq.MQ {
+	t.Helper()
+	mq, err := posixmq.New(fmt.Sprintf("/record-%d.tmp", rand.Uint64()),
+		posixmq.OptionCreateArgs(0600, 64, 10),
+		posixmq.OptionOflag(posixmq.OpenReadWrite|posixmq.OpenExclusive),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mq.Unlink() })
+	return mq
+}
+
+func TestWriterReader(t *testing.T) {
+	now := time.Now()
+	records := []Record{
+		{Time: now, Queue: "/a", Priority: 3, Data: []byte("one")},
+		{Time: now.Add(time.Millisecond), Queue: "/b", Priority: 0, Data: []byte{}},
+		{Time: now.Add(-time.Second), Queue: "/a", Priority: 32767, Data: bytes.Repeat([]byte{7}, 1000)},
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, rec := range records {
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+
+	r, err := NewReader(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range records {
+		rec, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		} else if !rec.Time.Equal(expected.Time) || rec.Queue != expected.Queue || rec.Priority != expected.Priority ||
+			!bytes.Equal(rec.Data, expected.Data) {
+			t.Fatalf("expected %+v, got %+v", expected, rec)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+
+	// Every cut inside a record is reported as truncated.
+	for n := len(magic) + 2; n < len(encoded); n++ {
+		r, err := NewReader(bytes.NewReader(encoded[:n]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for err == nil {
+			_, err = r.Next()
+		}
+		if err != io.EOF && !errors.As(err, new(ErrFormat)) {
+			t.Fatalf("cut at %d: unexpected error %v", n, err)
+		}
+	}
+}
+
+func TestNewReader_Header(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewWriter(&buf).Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := NewReader(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	} else if _, err := r.Next(); err != io.EOF {
+		t.Fatalf("expected an empty recording, got %v", err)
+	}
+
+	for _, tt := range []struct {
+		data     []byte
+		expected error
+	}{
+		{nil, ErrFormat{Reason: "missing header"}},
+		{[]byte("MQRX\x01"), ErrFormat{Reason: "bad magic"}},
+		{[]byte("MQRC\x09"), ErrVersion{Version: 9}},
+	} {
+		if _, err := NewReader(bytes.NewReader(tt.data)); !reflect.DeepEqual(err, tt.expected) {
+			t.Fatalf("%q: expected %v, got %v", tt.data, tt.expected, err)
+		}
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	src, dst := newTestMQ(t), newTestMQ(t)
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	tee := NewTee(src, w)
+	for i := range 3 {
+		if err := tee.Send(t, []byte{byte(i)}, uint(i)); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+
+	// Consuming the queue records the messages again, highest priority first.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	if n, err := NewRecorder(src, w).Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	} else if n != 3 {
+		t.Fatalf("expected 3 messages recorded, got %d", n)
+	}
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if n, err := Replay(context.Background(), r, dst, ReplaySpeed(2)); err != nil {
+		t.Fatal(err)
+	} else if n != 6 {
+		t.Fatalf("expected 6 messages replayed, got %d", n)
+	}
+	// The tee spaced its messages 50ms apart, replayed at double speed.
+	if elapsed := time.Since(start); elapsed < time.Millisecond*50 {
+		t.Fatalf("replay took %s, expected the recorded pace", elapsed)
+	}
+
+	var got []uint
+	for range 6 {
+		data, priority, err := dst.Receive(t)
+		if err != nil {
+			t.Fatal(err)
+		} else if uint(data[0]) != priority {
+			t.Fatalf("message %d replayed with priority %d", data[0], priority)
+		}
+		got = append(got, priority)
+	}
+	if expected := []uint{2, 2, 1, 1, 0, 0}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected priorities %v, got %v", expected, got)
+	}
+}
+
+func TestReplay_Filter(t *testing.T) {
+	dst := newTestMQ(t)
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	now := time.Now()
+	for i, queue := range []string{"/a", "/b", "/a"} {
+		// An hour between records, which a replay at max speed ignores.
+		if err := w.Write(Record{Time: now.Add(time.Hour * time.Duration(i)), Queue: queue, Data: []byte(queue)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := Replay(context.Background(), r, dst, ReplayQueue("/a"), ReplaySpeed(0)); err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Fatalf("expected 2 messages replayed, got %d", n)
+	}
+}
+
+func TestWriter_Mirror(t *testing.T) {
+	mq := newTestMQ(t)
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	m := posixmq.NewMirror(mq, w, posixmq.MirrorDirections(posixmq.MirrorReceive))
+
+	if err := mq.Send(t, []byte("live"), 4); err != nil {
+		t.Fatal(err)
+	} else if _, _, err := m.Receive(t); err != nil {
+		t.Fatal(err)
+	} else if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec, err := r.Next(); err != nil {
+		t.Fatal(err)
+	} else if rec.Queue != mq.Name() || rec.Priority != 4 || string(rec.Data) != "live" {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+}
+
+func TestTee_Expiry(t *testing.T) {
+	src := newTestMQ(t)
+	dst, err := posixmq.New(fmt.Sprintf("/record-%d.tmp", rand.Uint64()),
+		posixmq.OptionCreateArgs(0600, 64, 10),
+		posixmq.OptionOflag(posixmq.OpenReadWrite|posixmq.OpenExclusive),
+		posixmq.OptionExpiry(false, nil),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Unlink()
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	expiresAt := time.Now().Add(time.Hour).Round(0)
+	if err := NewTee(src, w).Send(t, []byte("ttl"), 1, posixmq.SendExpiresAt(expiresAt)); err != nil {
+		t.Fatal(err)
+	} else if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The recording keeps the expiry, so the replayed message still expires.
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := Replay(context.Background(), r, dst, ReplaySpeed(0)); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := dst.ReceiveMessage(t); err != nil {
+		t.Fatal(err)
+	} else if string(msg.Data) != "ttl" || !msg.ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("expected the replayed message to keep its expiry, got %+v", msg)
+	}
+}
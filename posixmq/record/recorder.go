@@ -0,0 +1,63 @@
+package record
+
+import (
+	"context"
+	"errors"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"github.com/bobcatalyst/go-mq/posixmq"
+	"time"
+)
+
+// Recorder consumes messages from a queue and records them.
+type Recorder struct {
+	mq *posixmq.MQ
+	w  *Writer
+}
+
+// NewRecorder creates a recorder consuming from mq, which must be opened for reading.
+func NewRecorder(mq *posixmq.MQ, w *Writer) *Recorder {
+	return &Recorder{mq: mq, w: w}
+}
+
+// Run records messages until ctx is done, returning the number of messages recorded.
+// Records are flushed whenever the queue is empty, and before returning.
+func (r *Recorder) Run(ctx context.Context) (n int, err error) {
+	defer func() { err = errors.Join(err, r.w.Flush()) }()
+	for ctx.Err() == nil {
+		msg, err := r.mq.ReceiveMessage(deadline.Step(ctx, deadline.PollInterval))
+		if errors.Is(err, posixmq.ErrSendRecvTimeout{}) {
+			if err := r.w.Flush(); err != nil {
+				return n, err
+			}
+			continue
+		} else if err != nil && !errors.Is(err, posixmq.ErrExpiryMissing{}) {
+			return n, err
+		}
+		if err := r.w.Write(Record{Time: time.Now(), Queue: r.mq.Name(), Priority: msg.Priority, Data: msg.Raw()}); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, ctx.Err()
+}
+
+// Tee records each message sent through it, leaving the queue to its usual consumers.
+type Tee struct {
+	mq *posixmq.MQ
+	w  *Writer
+}
+
+// NewTee creates a tee sending to mq.
+func NewTee(mq *posixmq.MQ, w *Writer) *Tee {
+	return &Tee{mq: mq, w: w}
+}
+
+// Send sends a message to the queue, recording it once it has been sent.
+// The recording is buffered, flush the [Writer] to write it out.
+func (t *Tee) Send(dl deadline.Deadline, data []byte, priority uint, opts ...posixmq.SendOption) error {
+	raw := posixmq.EncodeMessage(data, opts...)
+	if err := t.mq.Send(dl, raw, priority); err != nil {
+		return err
+	}
+	return t.w.Write(Record{Time: time.Now(), Queue: t.mq.Name(), Priority: priority, Data: raw})
+}
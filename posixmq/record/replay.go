@@ -0,0 +1,104 @@
+package record
+
+import (
+	"context"
+	"errors"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"github.com/bobcatalyst/go-mq/posixmq"
+	"io"
+	"time"
+)
+
+// ReplayOption represents options that can be applied to [Replay].
+type ReplayOption interface {
+	applyReplayOption(*replayConfig)
+}
+
+type replayConfig struct {
+	speed float64
+	queue string
+	all   bool
+}
+
+type (
+	replaySpeed float64
+	replayQueue string
+)
+
+// ReplaySpeed scales the pace of the replay, 2 replays twice as fast as recorded.
+// Zero or less sends messages as fast as the queue accepts them. The default is 1, the original pace.
+func ReplaySpeed(speed float64) ReplayOption { return replaySpeed(speed) }
+
+// ReplayQueue only replays messages recorded from the named queue, by default all messages are replayed.
+func ReplayQueue(name string) ReplayOption { return replayQueue(name) }
+
+func (opt replaySpeed) applyReplayOption(c *replayConfig) { c.speed = float64(opt) }
+func (opt replayQueue) applyReplayOption(c *replayConfig) { c.queue, c.all = string(opt), false }
+
+// Replay sends the records read from r to mq with their recorded priorities, returning the number sent.
+// The time between messages follows the recording, scaled by [ReplaySpeed]. A message delayed by a full queue
+// delays the rest, so the replay does not try to catch up.
+func Replay(ctx context.Context, r *Reader, mq *posixmq.MQ, opts ...ReplayOption) (n int, _ error) {
+	c := replayConfig{speed: 1, all: true}
+	for _, opt := range opts {
+		opt.applyReplayOption(&c)
+	}
+
+	var start, first time.Time // When the first message was sent, and recorded.
+	for {
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		} else if !c.all && rec.Queue != c.queue {
+			continue
+		}
+
+		if first.IsZero() {
+			start, first = time.Now(), rec.Time
+		} else if c.speed > 0 {
+			at := start.Add(time.Duration(float64(rec.Time.Sub(first)) / c.speed))
+			if err := sleepUntil(ctx, at); err != nil {
+				return n, err
+			}
+		}
+		if err := send(ctx, mq, rec); err != nil {
+			return n, err
+		}
+		// Time spent blocked on a full queue is not made up.
+		if c.speed > 0 {
+			if late := time.Since(start) - time.Duration(float64(rec.Time.Sub(first))/c.speed); late > 0 {
+				start = start.Add(late)
+			}
+		}
+		n++
+	}
+}
+
+// send sends a record, retrying while the queue is full until ctx is done.
+func send(ctx context.Context, mq *posixmq.MQ, rec Record) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		} else if err := mq.Send(deadline.Step(ctx, deadline.PollInterval), rec.Data, rec.Priority); !errors.Is(err, posixmq.ErrSendRecvTimeout{}) {
+			return err
+		}
+	}
+}
+
+// sleepUntil waits for t or for ctx to be done.
+func sleepUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,160 @@
+package record
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"github.com/bobcatalyst/go-mq/posixmq"
+	"golang.org/x/sys/unix"
+	"os"
+	"time"
+)
+
+// lockRetryInterval is how often a held snapshot lock is retried.
+const lockRetryInterval = time.Millisecond * 10
+
+// ErrReinject is returned by [Snapshot] when the messages could not all be sent back to the queue.
+// The messages that were not sent are written to Spill, so they can be restored with [Replay].
+type ErrReinject struct {
+	Sent  int    // Messages sent back to the queue.
+	Total int    // Messages in the snapshot.
+	Spill string // File holding the messages that were not sent, empty if spilling failed too.
+	Err   error
+}
+
+func (err ErrReinject) Error() string {
+	if err.Spill == "" {
+		return fmt.Sprintf("failed to reinject %d of %d messages, and to spill them: %v",
+			err.Total-err.Sent, err.Total, err.Err)
+	}
+	return fmt.Sprintf("failed to reinject %d of %d messages, they were spilled to %s: %v",
+		err.Total-err.Sent, err.Total, err.Spill, err.Err)
+}
+
+func (err ErrReinject) Unwrap() error { return err.Err }
+
+// SnapshotOption represents options that can be applied to [Snapshot].
+type SnapshotOption interface {
+	applySnapshotOption(*snapshotConfig)
+}
+
+type snapshotConfig struct {
+	spill string
+	send  func(mq *posixmq.MQ, dl deadline.Deadline, rec Record) error
+}
+
+type snapshotSpill string
+
+// SnapshotSpill sets the file messages are written to if they can't be sent back to the queue.
+// By default a new file is created in the temporary directory.
+func SnapshotSpill(path string) SnapshotOption { return snapshotSpill(path) }
+
+func (opt snapshotSpill) applySnapshotOption(c *snapshotConfig) { c.spill = string(opt) }
+
+// Snapshot returns the messages in the queue without consuming them. The queue is drained in the order
+// messages would be received, by priority then first in first out, and the messages are sent back
+// in the same order, which restores the queue. The queue must be opened with [posixmq.OpenReadWrite].
+// Messages are returned as stored, including any expiry header, whatever the queue's [posixmq.OptionExpiry].
+//
+// The snapshot is taken under an exclusive advisory lock of the first byte of the queue, using an open file
+// description lock, so it does not conflict with a [posixmq.NotifyLease]. Concurrent snapshots wait for each other.
+// Other processes only see the queue while it is drained if they ignore the lock, a process can take a shared
+// F_OFD_SETLKW lock of the same byte to wait for snapshots to finish.
+//
+// dl bounds waiting for the lock, and waiting for space in the queue when sending the messages back.
+// If a message can't be sent back, the rest are spilled to a file and [ErrReinject] is returned
+// along with the snapshot.
+func Snapshot(dl deadline.Deadline, mq *posixmq.MQ, opts ...SnapshotOption) ([]Record, error) {
+	c := snapshotConfig{send: func(mq *posixmq.MQ, dl deadline.Deadline, rec Record) error {
+		_, err := posixmq.RawSendReceive(mq.Mqd(), dl, rec.Data, rec.Priority)
+		return err
+	}}
+	for _, opt := range opts {
+		opt.applySnapshotOption(&c)
+	}
+
+	if err := lockSnapshot(dl, mq.Mqd(), unix.F_WRLCK); err != nil {
+		return nil, err
+	}
+	defer lockSnapshot(deadline.Past, mq.Mqd(), unix.F_UNLCK)
+
+	attr, err := mq.GetAttr()
+	if err != nil {
+		return nil, err
+	}
+	// Messages are drained and sent back raw, so expiry headers are kept and expired messages are not discarded.
+	buf := make([]byte, attr.MaxMessageSize)
+	var records []Record
+	for {
+		var priority uint
+		n, err := posixmq.RawSendReceive(mq.Mqd(), deadline.Past, buf, &priority)
+		if errors.Is(err, posixmq.ErrSendRecvTimeout{}) || errors.Is(err, posixmq.ErrRecvEmptyQueue{}) {
+			break
+		} else if err != nil {
+			// Whatever was drained must still be put back.
+			return records, errors.Join(err, c.reinject(dl, mq, records))
+		}
+		records = append(records, Record{
+			Time:     time.Now(),
+			Queue:    mq.Name(),
+			Priority: priority,
+			Data:     bytes.Clone(buf[:n]),
+		})
+	}
+	return records, c.reinject(dl, mq, records)
+}
+
+// reinject sends the records back to the queue, spilling the rest if a send fails.
+func (c snapshotConfig) reinject(dl deadline.Deadline, mq *posixmq.MQ, records []Record) error {
+	for i, rec := range records {
+		if err := c.send(mq, dl, rec); err != nil {
+			spill, spillErr := c.writeSpill(records[i:])
+			return ErrReinject{Sent: i, Total: len(records), Spill: spill, Err: errors.Join(err, spillErr)}
+		}
+	}
+	return nil
+}
+
+// writeSpill writes records to the spill file, returning its path.
+func (c snapshotConfig) writeSpill(records []Record) (string, error) {
+	var f *os.File
+	var err error
+	if c.spill == "" {
+		f, err = os.CreateTemp("", "mq-snapshot-*.mqrec")
+	} else {
+		f, err = os.OpenFile(c.spill, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	w := NewWriter(f)
+	for _, rec := range records {
+		if err = w.Write(rec); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err = errors.Join(err, f.Sync(), f.Close()); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// lockSnapshot sets an open file description lock of the first byte of the queue, retrying until dl passes.
+func lockSnapshot(dl deadline.Deadline, mqd int, typ int16) error {
+	lk := unix.Flock_t{Type: typ, Whence: 0, Start: 0, Len: 1}
+	for {
+		err := unix.FcntlFlock(uintptr(mqd), unix.F_OFD_SETLK, &lk)
+		if err == nil {
+			return nil
+		} else if !errors.Is(err, unix.EAGAIN) && !errors.Is(err, unix.EACCES) && !errors.Is(err, unix.EINTR) {
+			return fmt.Errorf("failed to lock queue: %w", err)
+		} else if !deadline.Sleep(dl, lockRetryInterval) {
+			return posixmq.ErrSendRecvTimeout{}
+		}
+	}
+}
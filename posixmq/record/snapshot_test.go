@@ -0,0 +1,176 @@
+package record
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"github.com/bobcatalyst/go-mq/posixmq"
+	"golang.org/x/sys/unix"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type sent struct {
+	data     string
+	priority uint
+}
+
+func fill(t *testing.T, mq *posixmq.MQ) []sent {
+	t.Helper()
+	msgs := []sent{{"a", 1}, {"b", 5}, {"c", 1}, {"d", 0}, {"e", 5}}
+	for _, m := range msgs {
+		if err := mq.Send(t, []byte(m.data), m.priority); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The order they are received in.
+	return []sent{{"b", 5}, {"e", 5}, {"a", 1}, {"c", 1}, {"d", 0}}
+}
+
+func toSent(records []Record) []sent {
+	var got []sent
+	for _, rec := range records {
+		got = append(got, sent{string(rec.Data), rec.Priority})
+	}
+	return got
+}
+
+func TestSnapshot(t *testing.T) {
+	mq := newTestMQ(t)
+	expected := fill(t, mq)
+
+	records, err := Snapshot(t, mq)
+	if err != nil {
+		t.Fatal(err)
+	} else if got := toSent(records); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected snapshot %v, got %v", expected, got)
+	}
+
+	// The queue is left as it was.
+	var got []sent
+	for range expected {
+		data, priority, err := mq.Receive(t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, sent{string(data), priority})
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected queue %v after snapshot, got %v", expected, got)
+	}
+}
+
+func TestSnapshot_Lock(t *testing.T) {
+	mq := newTestMQ(t)
+	other, err := posixmq.New(mq.Name(), posixmq.OptionOflag(posixmq.OpenReadWrite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	if err := lockSnapshot(t, other.Mqd(), unix.F_WRLCK); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Snapshot(deadline.TimeDeadline(time.Now().Add(time.Millisecond*50)), mq); !errors.Is(err, posixmq.ErrSendRecvTimeout{}) {
+		t.Fatalf("expected ErrSendRecvTimeout while locked, got %v", err)
+	}
+}
+
+type snapshotSend func(mq *posixmq.MQ, dl deadline.Deadline, rec Record) error
+
+func (opt snapshotSend) applySnapshotOption(c *snapshotConfig) { c.send = opt }
+
+func TestSnapshot_Spill(t *testing.T) {
+	mq := newTestMQ(t)
+	expected := fill(t, mq)
+	spill := filepath.Join(t.TempDir(), "spill.mqrec")
+
+	failure := errors.New("send failed")
+	n := 0
+	records, err := Snapshot(t, mq, SnapshotSpill(spill), snapshotSend(func(mq *posixmq.MQ, dl deadline.Deadline, rec Record) error {
+		if n++; n > 2 {
+			return failure
+		}
+		return mq.Send(dl, rec.Data, rec.Priority)
+	}))
+
+	var reinject ErrReinject
+	if !errors.As(err, &reinject) || !errors.Is(err, failure) {
+		t.Fatalf("expected ErrReinject, got %v", err)
+	} else if reinject.Sent != 2 || reinject.Total != 5 || reinject.Spill != spill {
+		t.Fatalf("unexpected error %+v", reinject)
+	} else if got := toSent(records); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected snapshot %v, got %v", expected, got)
+	}
+
+	f, err := os.Open(spill)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spilled []Record
+	for {
+		rec, err := r.Next()
+		if err != nil {
+			break
+		}
+		spilled = append(spilled, rec)
+	}
+	if got := toSent(spilled); !reflect.DeepEqual(got, expected[2:]) {
+		t.Fatalf("expected spilled %v, got %v", expected[2:], got)
+	}
+}
+
+func TestSnapshot_Raw(t *testing.T) {
+	// Neither decoding expiry headers nor strict mode may change what is in the queue.
+	for _, strict := range []bool{false, true} {
+		mq, err := posixmq.New(fmt.Sprintf("/record-%d.tmp", rand.Uint64()),
+			posixmq.OptionCreateArgs(0600, 64, 10),
+			posixmq.OptionOflag(posixmq.OpenReadWrite|posixmq.OpenExclusive),
+			posixmq.OptionExpiry(strict, nil),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mq.Unlink()
+
+		expected := [][]byte{
+			posixmq.EncodeMessage([]byte("expired"), posixmq.SendExpiresAt(time.Unix(1, 0))),
+			posixmq.EncodeMessage([]byte("fresh"), posixmq.SendExpiresAt(time.Now().Add(time.Hour))),
+			[]byte("plain"),
+		}
+		for _, data := range expected {
+			if _, err := posixmq.RawSendReceive(mq.Mqd(), t, data, uint(0)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		records, err := Snapshot(t, mq)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(records) != len(expected) {
+			t.Fatalf("expected %d records, got %d", len(expected), len(records))
+		}
+		buf := make([]byte, 64)
+		for i, data := range expected {
+			if !bytes.Equal(records[i].Data, data) {
+				t.Fatalf("strict %v: expected record %q, got %q", strict, data, records[i].Data)
+			}
+			var priority uint
+			if n, err := posixmq.RawSendReceive(mq.Mqd(), deadline.Past, buf, &priority); err != nil {
+				t.Fatal(err)
+			} else if !bytes.Equal(buf[:n], data) {
+				t.Fatalf("strict %v: expected %q in the queue after the snapshot, got %q", strict, data, buf[:n])
+			}
+		}
+	}
+}
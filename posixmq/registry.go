@@ -0,0 +1,309 @@
+package posixmq
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// UnlinkPolicy decides what [SharedMQ.Unlink] does while other components still hold the queue.
+type UnlinkPolicy int
+
+const (
+	// UnlinkOnLastRelease defers unlinking until the last handle to the queue is released.
+	UnlinkOnLastRelease UnlinkPolicy = iota
+	// UnlinkImmediately unlinks the name straight away, open handles keep working on the removed queue.
+	UnlinkImmediately
+	// UnlinkNever refuses to unlink queues opened through the registry.
+	UnlinkNever
+)
+
+// ErrUnlinkNotAllowed is returned by [SharedMQ.Unlink] when the registry's policy is [UnlinkNever].
+type ErrUnlinkNotAllowed struct{}
+
+func (ErrUnlinkNotAllowed) Error() string {
+	return "the registry does not allow unlinking queues"
+}
+
+// ErrHandleReleased is returned when using a [SharedMQ] after it has been released.
+type ErrHandleReleased struct{}
+
+func (ErrHandleReleased) Error() string {
+	return "the shared queue handle has been released"
+}
+
+// RegistryOption represents options that can be applied when creating a [Registry].
+type RegistryOption interface {
+	applyRegistryOption(*Registry)
+}
+
+type (
+	registryUnlinkPolicy UnlinkPolicy
+	registryRecheck      time.Duration
+)
+
+// RegistryUnlinkPolicy sets how unlinking is coordinated, the default is [UnlinkOnLastRelease].
+func RegistryUnlinkPolicy(policy UnlinkPolicy) RegistryOption { return registryUnlinkPolicy(policy) }
+
+// RegistryRecheck sets how often [SharedMQ.MQ] checks whether the queue was unlinked and recreated.
+// The default is every second, zero checks on every call.
+func RegistryRecheck(interval time.Duration) RegistryOption { return registryRecheck(interval) }
+
+func (opt registryUnlinkPolicy) applyRegistryOption(r *Registry) { r.policy = UnlinkPolicy(opt) }
+func (opt registryRecheck) applyRegistryOption(r *Registry)      { r.recheck = time.Duration(opt) }
+
+// Registry hands out reference-counted handles to queues, so components of a process opening the same queue
+// share one descriptor instead of each holding their own.
+//
+// Handles are shared per name, namespace and oflag, ignoring [OpenCreate] and [OpenExclusive], so a component
+// creating the queue and one opening it share a handle. Options only take effect for the first component
+// to open the queue. The descriptor is closed once every handle has been released.
+type Registry struct {
+	policy  UnlinkPolicy
+	recheck time.Duration
+
+	mu      sync.Mutex
+	entries map[registryKey]*registryEntry
+}
+
+type registryKey struct {
+	name  string
+	ns    *Namespace
+	oflag OpenFlag
+}
+
+// registryEntry is an open queue shared by all handles with the same key.
+type registryEntry struct {
+	key  registryKey
+	opts []MQOption // Options the queue was opened with, used to reopen it.
+	refs int
+
+	mu            sync.Mutex
+	mq            *MQ
+	retired       []*MQ // Queues replaced after being recreated, closed with the entry as handles may still use them.
+	checked       time.Time
+	unlinkPending bool
+}
+
+// SharedMQ is a handle to a queue opened through a [Registry].
+type SharedMQ struct {
+	r        *Registry
+	e        *registryEntry
+	released bool
+
+	viewMu sync.Mutex
+	views  map[*MQ]*MQ // Views of the entry's queues, each with the handle's own receive buffer.
+}
+
+// NewRegistry creates a registry. Most programs should use [OpenShared] instead,
+// which uses a process wide registry.
+func NewRegistry(opts ...RegistryOption) *Registry {
+	r := &Registry{
+		recheck: time.Second,
+		entries: map[registryKey]*registryEntry{},
+	}
+	for _, opt := range opts {
+		opt.applyRegistryOption(r)
+	}
+	return r
+}
+
+var defaultRegistry = NewRegistry()
+
+// OpenShared opens a handle to the queue from the process wide registry, see [Registry.Open].
+func OpenShared(name string, opts ...MQOption) (*SharedMQ, error) {
+	return defaultRegistry.Open(name, opts...)
+}
+
+// Open returns a handle to the queue, opening it with opts if no other handle to it is held.
+// If the queue was unlinked and recreated since it was opened, the new queue is opened.
+func (r *Registry) Open(name string, opts ...MQOption) (*SharedMQ, error) {
+	probe := &MQ{name: name}
+	for _, opt := range opts {
+		opt.applyOption(probe)
+	}
+	key := registryKey{name: name, ns: probe.ns, oflag: probe.oflag &^ (OpenCreate | OpenExclusive)}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, ok := r.entries[key]; ok {
+		e.mu.Lock()
+		err := e.refresh(true)
+		e.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		e.refs++
+		return &SharedMQ{r: r, e: e}, nil
+	}
+
+	mq, err := New(name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	e := &registryEntry{key: key, opts: opts, refs: 1, mq: mq, checked: time.Now()}
+	r.entries[key] = e
+	return &SharedMQ{r: r, e: e}, nil
+}
+
+// Name returns the name of the queue.
+func (s *SharedMQ) Name() string {
+	return s.e.key.name
+}
+
+// MQ returns the shared queue. If the queue was unlinked and recreated, the new queue is opened and returned.
+// Queues returned earlier stay open until every handle is released.
+// The queue must not be closed or unlinked directly, use [SharedMQ.Release] and [SharedMQ.Unlink].
+//
+// The descriptor is shared with the other handles, but each handle gets its own receive buffer,
+// so different handles can receive at the same time. Like any [MQ], one handle's queue must not
+// receive from several goroutines at once.
+func (s *SharedMQ) MQ() (*MQ, error) {
+	s.r.mu.Lock()
+	released := s.released
+	s.r.mu.Unlock()
+	if released {
+		return nil, ErrHandleReleased{}
+	}
+
+	s.e.mu.Lock()
+	err := s.e.refresh(time.Since(s.e.checked) >= s.r.recheck)
+	mq := s.e.mq
+	s.e.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	s.viewMu.Lock()
+	defer s.viewMu.Unlock()
+	v, ok := s.views[mq]
+	if !ok {
+		if s.views == nil {
+			s.views = map[*MQ]*MQ{}
+		}
+		v = mq.view()
+		s.views[mq] = v
+	}
+	return v, nil
+}
+
+// Release gives up the handle. The queue is closed when its last handle is released,
+// and unlinked if an unlink was deferred by [UnlinkOnLastRelease].
+func (s *SharedMQ) Release() error {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	if s.released {
+		return nil
+	}
+	s.released = true
+
+	e := s.e
+	if e.refs--; e.refs > 0 {
+		return nil
+	}
+	delete(s.r.entries, e.key)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var err error
+	if e.unlinkPending {
+		// The name is left alone if it now belongs to a queue recreated by someone else.
+		var stale bool
+		if stale, err = e.mq.recreated(); err == nil && !stale {
+			err = e.mq.unlink()
+		}
+	}
+	err = errors.Join(err, e.mq.Close())
+	for _, mq := range e.retired {
+		err = errors.Join(err, mq.Close())
+	}
+	return err
+}
+
+// Unlink removes the queue's name according to the registry's [UnlinkPolicy].
+func (s *SharedMQ) Unlink() error {
+	s.r.mu.Lock()
+	released := s.released
+	s.r.mu.Unlock()
+	if released {
+		return ErrHandleReleased{}
+	}
+
+	switch s.r.policy {
+	case UnlinkNever:
+		return ErrUnlinkNotAllowed{}
+	case UnlinkImmediately:
+		mq, err := s.MQ()
+		if err != nil {
+			return err
+		}
+		return mq.unlink()
+	default:
+		s.e.mu.Lock()
+		s.e.unlinkPending = true
+		s.e.mu.Unlock()
+		return nil
+	}
+}
+
+// refresh reopens the queue if its name now refers to a different queue. Must be called with e.mu held.
+func (e *registryEntry) refresh(check bool) error {
+	if !check {
+		return nil
+	}
+	e.checked = time.Now()
+
+	stale, err := e.mq.recreated()
+	if err != nil || !stale {
+		return err
+	}
+	mq, err := New(e.key.name, slices.Concat(e.opts, []MQOption{OptionOflag(e.key.oflag)})...)
+	if err != nil {
+		return err
+	}
+	e.retired = append(e.retired, e.mq)
+	e.mq = mq
+	return nil
+}
+
+// view returns a queue using the descriptor, scheduler and close of mq, with its own receive buffer.
+func (mq *MQ) view() *MQ {
+	return &MQ{
+		name:      mq.name,
+		bname:     mq.bname,
+		attr:      mq.attr,
+		mode:      mq.mode,
+		oflag:     mq.oflag,
+		ns:        mq.ns,
+		exactMode: mq.exactMode,
+		mqd:       mq.mqd,
+		close:     mq.close,
+		unlink:    mq.unlink,
+		expiry:    mq.expiry,
+		schedOpts: mq.schedOpts,
+		owner:     mq,
+	}
+}
+
+// recreated reports whether the queue's name now refers to a different queue.
+// A name that no longer exists is not reported, the queue can still be used through open descriptors.
+func (mq *MQ) recreated() (bool, error) {
+	mqd, err := mq.rawOpen(mq.oflag &^ (OpenCreate | OpenExclusive))
+	if errors.Is(err, ErrOpenNoEntry{}) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer RawClose(mqd)
+
+	current, err := RawStat(mqd)
+	if err != nil {
+		return false, err
+	}
+	opened, err := mq.Stat()
+	if err != nil {
+		return false, err
+	}
+	return current.Inode != opened.Inode || current.Dev != opened.Dev, nil
+}
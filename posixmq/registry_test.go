@@ -0,0 +1,153 @@
+package posixmq
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegistry_Open(t *testing.T) {
+	r := NewRegistry()
+	name := randName()
+	a, err := r.Open(name, OptionCreateArgs(0644, 1, 1), OptionOflag(OpenReadWrite|OpenExclusive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RawUnlink(name)
+	b, err := r.Open(name, OptionOflag(OpenReadWrite))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mqa, err := a.MQ()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mqb, err := b.MQ()
+	if err != nil {
+		t.Fatal(err)
+	} else if mqa.Mqd() != mqb.Mqd() {
+		t.Fatal("expected handles to share the queue")
+	}
+
+	// Each handle receives into its own buffer.
+	if err := mqa.Send(t, []byte{1}, 0); err != nil {
+		t.Fatal(err)
+	}
+	da, _, err := mqa.Receive(t)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := mqa.Send(t, []byte{2}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if db, _, err := mqb.Receive(t); err != nil {
+		t.Fatal(err)
+	} else if da[0] != 1 || db[0] != 2 {
+		t.Fatalf("expected messages 1 and 2, got %v and %v", da, db)
+	}
+
+	if err := a.Release(); err != nil {
+		t.Fatal(err)
+	} else if _, err := a.MQ(); !errors.Is(err, ErrHandleReleased{}) {
+		t.Fatalf("expected ErrHandleReleased, got %v", err)
+	} else if err := mqb.Send(t, []byte{1}, 0); err != nil {
+		t.Fatalf("queue closed while a handle is held: %v", err)
+	}
+
+	if err := b.Release(); err != nil {
+		t.Fatal(err)
+	} else if len(r.entries) != 0 {
+		t.Fatalf("expected queue to be closed after the last release, %d open", len(r.entries))
+	}
+}
+
+func TestSharedMQ_Unlink(t *testing.T) {
+	for _, test := range []struct {
+		name           string
+		policy         UnlinkPolicy
+		err            error
+		existsAfter    bool // Whether the name exists after Unlink, before the last release.
+		existsReleased bool
+	}{
+		{name: "on last release", policy: UnlinkOnLastRelease, existsAfter: true},
+		{name: "immediately", policy: UnlinkImmediately},
+		{name: "never", policy: UnlinkNever, err: ErrUnlinkNotAllowed{}, existsAfter: true, existsReleased: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := NewRegistry(RegistryUnlinkPolicy(test.policy))
+			name := randName()
+			a, err := r.Open(name, OptionCreateArgs(0644, 1, 1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer RawUnlink(name)
+			b, err := r.Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			exists := func() bool {
+				mqd, err := RawOpen(name, OpenReadOnly, 0, nil)
+				if err != nil {
+					return false
+				}
+				RawClose(mqd)
+				return true
+			}
+
+			if err := a.Unlink(); !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			} else if err := a.Release(); err != nil {
+				t.Fatal(err)
+			} else if exists() != test.existsAfter {
+				t.Fatalf("expected name to exist before the last release: %t", test.existsAfter)
+			}
+			if err := b.Release(); err != nil {
+				t.Fatal(err)
+			} else if exists() != test.existsReleased {
+				t.Fatalf("expected name to exist after the last release: %t", test.existsReleased)
+			}
+		})
+	}
+}
+
+func TestSharedMQ_Recreated(t *testing.T) {
+	r := NewRegistry(RegistryRecheck(0))
+	name := randName()
+	s, err := r.Open(name, OptionCreateArgs(0644, 1, 1), OptionOflag(OpenReadWrite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Release()
+	old, err := s.MQ()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RawUnlink(name); err != nil {
+		t.Fatal(err)
+	} else if mq, err := s.MQ(); err != nil {
+		t.Fatal(err)
+	} else if mq != old {
+		t.Fatal("expected unlinked queue to stay in use until recreated")
+	}
+
+	other, err := New(name, OptionCreateArgs(0644, 1, 1), OptionOflag(OpenReadWrite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Unlink()
+	if err := other.Send(t, []byte{1}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	mq, err := s.MQ()
+	if err != nil {
+		t.Fatal(err)
+	} else if mq == old {
+		t.Fatal("expected recreated queue to be reopened")
+	} else if data, _, err := mq.Receive(t); err != nil {
+		t.Fatal(err)
+	} else if data[0] != 1 {
+		t.Fatalf("expected message from recreated queue, got %v", data)
+	}
+}
@@ -0,0 +1,287 @@
+package posixmq
+
+import (
+	"errors"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"golang.org/x/sys/unix"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// ReopenEvent reports that a [ResilientMQ] found its queue was unlinked and recreated.
+type ReopenEvent struct {
+	Name string
+	Old  Stat  // The queue that was replaced.
+	New  Stat  // The queue now in use, zero if reopening failed.
+	Err  error // Why reopening failed, the old queue stays in use until the next check.
+}
+
+// ResilientOption represents options that can be applied when creating a [ResilientMQ].
+type ResilientOption interface {
+	applyResilientOption(*ResilientMQ)
+}
+
+type (
+	resilientOnReopen func(ReopenEvent)
+	resilientInterval time.Duration
+	resilientWatchDir string
+)
+
+// ResilientOnReopen sets a function called after each attempt to reopen the queue.
+func ResilientOnReopen(fn func(ReopenEvent)) ResilientOption { return resilientOnReopen(fn) }
+
+// ResilientCheckInterval sets how often the queue is checked when it can't be watched with inotify, default 1s.
+// Blocking calls are split into waits of at most this long, so they move to a reopened queue.
+func ResilientCheckInterval(d time.Duration) ResilientOption { return resilientInterval(d) }
+
+// ResilientWatchDir sets where the mqueue filesystem is mounted for inotify, default /dev/mqueue.
+// An empty dir disables inotify. If the directory can't be watched, the queue is polled instead.
+func ResilientWatchDir(dir string) ResilientOption { return resilientWatchDir(dir) }
+
+func (opt resilientOnReopen) applyResilientOption(r *ResilientMQ) { r.onReopen = opt }
+func (opt resilientInterval) applyResilientOption(r *ResilientMQ) { r.interval = time.Duration(opt) }
+func (opt resilientWatchDir) applyResilientOption(r *ResilientMQ) { r.watchDir = string(opt) }
+
+// ResilientMQ is a queue that reopens itself by name when the queue is unlinked and recreated by another process.
+// Without it, a long-lived [MQ] keeps using the orphaned queue, which no other process can reach.
+//
+// The queue is reopened with its original options, without [OpenExclusive]. Messages left in the orphaned queue
+// are lost when it is closed.
+type ResilientMQ struct {
+	name     string
+	opts     []MQOption // Original options, with OpenExclusive removed.
+	onReopen func(ReopenEvent)
+	interval time.Duration
+	watchDir string
+
+	mu sync.RWMutex // Held for reading while the queue is in use, so it is not closed during a call.
+	mq *MQ
+
+	checkMu sync.Mutex // Serializes checks.
+	done    chan struct{}
+	wg      sync.WaitGroup
+	watch   *os.File // inotify instance, nil when polling.
+	close   func() error
+}
+
+// NewResilientMQ opens the queue with opts and starts watching for it to be recreated.
+func NewResilientMQ(name string, opts []MQOption, ropts ...ResilientOption) (*ResilientMQ, error) {
+	mq, err := New(name, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ResilientMQ{
+		name:     name,
+		opts:     slices.Concat(opts, []MQOption{OptionOflag(mq.oflag &^ OpenExclusive)}),
+		interval: time.Second,
+		watchDir: mqueueDir,
+		mq:       mq,
+		done:     make(chan struct{}),
+	}
+	for _, opt := range ropts {
+		opt.applyResilientOption(r)
+	}
+	r.close = sync.OnceValue(r.doClose)
+
+	events := make(chan struct{}, 1)
+	if r.watchDir != "" && mq.ns == nil {
+		r.watch = r.startWatch(events)
+	}
+	r.wg.Add(1)
+	go r.run(events)
+	return r, nil
+}
+
+// Name returns the name of the queue.
+func (r *ResilientMQ) Name() string {
+	return r.name
+}
+
+// Do calls fn with the queue currently in use. The queue is not replaced while fn runs,
+// so fn should not block for long and must not keep the queue after returning.
+func (r *ResilientMQ) Do(fn func(mq *MQ) error) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return fn(r.mq)
+}
+
+// Send sends a message to the queue. While the queue is full, the send is retried on the reopened queue
+// if it is replaced.
+func (r *ResilientMQ) Send(dl deadline.Deadline, data []byte, priority uint, opts ...SendOption) error {
+	for {
+		step, last := r.step(dl)
+		err := r.Do(func(mq *MQ) error { return mq.Send(step, data, priority, opts...) })
+		if last || !errors.Is(err, ErrSendRecvTimeout{}) {
+			return err
+		}
+	}
+}
+
+// Receive retrieves a message from the queue, moving to the reopened queue if it is replaced while waiting.
+// Like [MQ.Receive], it is not safe to call concurrently and the returned data is invalid after the next call.
+func (r *ResilientMQ) Receive(dl deadline.Deadline) (data []byte, priority uint, _ error) {
+	for {
+		step, last := r.step(dl)
+		err := r.Do(func(mq *MQ) (err error) {
+			data, priority, err = mq.Receive(step)
+			return err
+		})
+		if last || !errors.Is(err, ErrSendRecvTimeout{}) {
+			return data, priority, err
+		}
+	}
+}
+
+// step limits a wait to the check interval, reporting whether dl is reached first.
+func (r *ResilientMQ) step(dl deadline.Deadline) (deadline.Deadline, bool) {
+	next := time.Now().Add(r.interval)
+	if t, ok := dl.Deadline(); ok && !t.IsZero() && !t.After(next) {
+		return dl, true
+	}
+	return deadline.TimeDeadline(next), false
+}
+
+// Check reopens the queue if its name now refers to a different queue.
+// Checks happen automatically, Check is only needed to react to a known recreation sooner.
+func (r *ResilientMQ) Check() error {
+	r.checkMu.Lock()
+	defer r.checkMu.Unlock()
+	select {
+	case <-r.done:
+		return nil
+	default:
+	}
+
+	var old Stat
+	var stale bool
+	err := r.Do(func(mq *MQ) (err error) {
+		if stale, err = mq.recreated(); err == nil && stale {
+			old, err = mq.Stat()
+		}
+		return err
+	})
+	if err != nil || !stale {
+		return err
+	}
+
+	ev := ReopenEvent{Name: r.name, Old: old}
+	mq, err := New(r.name, r.opts...)
+	if err == nil {
+		if ev.New, err = mq.Stat(); err != nil {
+			err = errors.Join(err, mq.Close())
+		}
+	}
+	if err != nil {
+		ev.Err = err
+		r.notify(ev)
+		return err
+	}
+
+	r.mu.Lock()
+	prev := r.mq
+	r.mq = mq
+	r.mu.Unlock()
+	err = prev.Close()
+	r.notify(ev)
+	return err
+}
+
+func (r *ResilientMQ) notify(ev ReopenEvent) {
+	if r.onReopen != nil {
+		r.onReopen(ev)
+	}
+}
+
+// Close stops watching and closes the queue.
+func (r *ResilientMQ) Close() error {
+	return r.close()
+}
+
+// Unlink unlinks and closes the queue.
+func (r *ResilientMQ) Unlink() error {
+	// Unlink first, closing releases the namespace the queue is unlinked in.
+	err := r.Do(func(mq *MQ) error { return mq.unlink() })
+	return errors.Join(r.Close(), err)
+}
+
+func (r *ResilientMQ) doClose() error {
+	r.checkMu.Lock()
+	close(r.done)
+	r.checkMu.Unlock()
+
+	var err error
+	if r.watch != nil {
+		err = r.watch.Close()
+	}
+	r.wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return errors.Join(err, r.mq.Close())
+}
+
+// run checks the queue when the watched directory changes, or every interval when polling.
+func (r *ResilientMQ) run(events <-chan struct{}) {
+	defer r.wg.Done()
+	var tick <-chan time.Time
+	if r.watch == nil {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-tick:
+		case <-events:
+		}
+		_ = r.Check()
+	}
+}
+
+// startWatch watches the mqueue directory for the queue's name being created,
+// returning nil if the directory can't be watched.
+func (r *ResilientMQ) startWatch(events chan<- struct{}) *os.File {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil
+	} else if _, err := unix.InotifyAddWatch(fd, r.watchDir, unix.IN_CREATE|unix.IN_MOVED_TO); err != nil {
+		unix.Close(fd)
+		return nil
+	}
+	f := os.NewFile(uintptr(fd), "mq-inotify")
+
+	base := strings.TrimPrefix(r.name, "/")
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		buf := make([]byte, 4096)
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				if errors.Is(err, os.ErrClosed) {
+					return
+				}
+				continue
+			}
+			for b := buf[:n]; len(b) >= unix.SizeofInotifyEvent; {
+				ev := (*unix.InotifyEvent)(unsafe.Pointer(&b[0]))
+				name := strings.TrimRight(string(b[unix.SizeofInotifyEvent:unix.SizeofInotifyEvent+ev.Len]), "\x00")
+				b = b[unix.SizeofInotifyEvent+ev.Len:]
+				if name == base || ev.Mask&unix.IN_Q_OVERFLOW != 0 {
+					select {
+					case events <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}
+	}()
+	return f
+}
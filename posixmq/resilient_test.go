@@ -0,0 +1,80 @@
+package posixmq
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestResilientMQ(t *testing.T) {
+	name := randName()
+	opts := []MQOption{OptionCreateArgs(0644, 1, 1), OptionOflag(OpenReadWrite | OpenExclusive)}
+	events := make(chan ReopenEvent, 1)
+	r, err := NewResilientMQ(name, opts,
+		ResilientWatchDir(""),
+		ResilientCheckInterval(time.Millisecond*10),
+		ResilientOnReopen(func(ev ReopenEvent) { events <- ev }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Unlink()
+
+	received := make(chan error, 1)
+	go func() {
+		data, _, err := r.Receive(t)
+		if err == nil && data[0] != 2 {
+			t.Errorf("expected message from the recreated queue, got %v", data)
+		}
+		received <- err
+	}()
+
+	// Recreate the queue the way another process would after a deploy.
+	if err := RawUnlink(name); err != nil {
+		t.Fatal(err)
+	}
+	other, err := New(name, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	select {
+	case ev := <-events:
+		if ev.Err != nil {
+			t.Fatal(ev.Err)
+		} else if ev.Old.Inode == ev.New.Inode {
+			t.Fatalf("expected a different queue after reopening, both have inode %d", ev.New.Inode)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("recreated queue was not reopened")
+	}
+
+	if err := other.Send(t, []byte{2}, 0); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-received:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("receive did not move to the recreated queue")
+	}
+}
+
+func TestResilientMQ_UnlinkNamespace(t *testing.T) {
+	ns := newTestNamespace(t)
+	name := randName()
+	r, err := NewResilientMQ(name, []MQOption{OptionCreateArgs(0644, 1, 1), OptionOflag(OpenReadWrite), OptionNamespace(ns)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Unlink(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RawOpenNamespace(ns, name, OpenReadOnly, 0, nil); !errors.Is(err, ErrOpenNoEntry{}) {
+		t.Fatalf("expected queue to be unlinked, got %v", err)
+	}
+}
@@ -0,0 +1,289 @@
+// Package router forwards messages from one queue to many, choosing the output of each message by its content.
+//
+// A [Router] receives from its input queue and checks each message against its rules in order,
+// forwarding it to the output of the first matching [Route], or to the default route if none match.
+// Routes can be replaced while the router runs, each message is routed by the routes in place when it was received.
+package router
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"github.com/bobcatalyst/go-mq/posixmq"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Message is a message being routed. Data is only valid until the router receives the next message.
+type Message struct {
+	Data      []byte
+	Priority  uint
+	ExpiresAt time.Time         // Kept when forwarding, see [posixmq.Message].
+	Headers   map[string]string // Parsed by the router's [HeaderParser], nil without one.
+}
+
+// HeaderParser extracts the headers of a message for [HeaderEquals].
+type HeaderParser func(data []byte) (map[string]string, error)
+
+// Matcher decides whether a message takes a route. Any func(Message) bool can be used as a predicate.
+type Matcher func(Message) bool
+
+// HeaderEquals matches messages with a header of the given value. It needs the router to have a [HeaderParser].
+func HeaderEquals(key, value string) Matcher {
+	return func(m Message) bool {
+		v, ok := m.Headers[key]
+		return ok && v == value
+	}
+}
+
+// PayloadPrefix matches messages starting with prefix.
+func PayloadPrefix(prefix []byte) Matcher {
+	return func(m Message) bool { return bytes.HasPrefix(m.Data, prefix) }
+}
+
+// PayloadRegexp matches messages containing a match of re.
+func PayloadRegexp(re *regexp.Regexp) Matcher {
+	return func(m Message) bool { return re.Match(m.Data) }
+}
+
+// PriorityRange matches messages with a priority from low to high inclusive.
+func PriorityRange(low, high uint) Matcher {
+	return func(m Message) bool { return m.Priority >= low && m.Priority <= high }
+}
+
+// FixedPriority rewrites every priority of a route to priority.
+func FixedPriority(priority uint) func(uint) uint {
+	return func(uint) uint { return priority }
+}
+
+// Route forwards the messages it matches to an output queue.
+type Route struct {
+	Name     string          // Identifies the route in [Metrics] and errors.
+	Match    Matcher         // Required for rules, ignored for the default route.
+	Output   *posixmq.MQ     // Must be opened for writing.
+	Priority func(uint) uint // Rewrites the priority of forwarded messages, nil keeps it.
+}
+
+// Routes is the routing table of a [Router].
+type Routes struct {
+	Rules   []Route // Checked in order, the first route matching a message takes it.
+	Default *Route  // Takes messages no rule matches. Without one they are dropped and counted as unmatched.
+}
+
+// ErrInvalidRoute is returned when setting routes that can't be used, leaving the previous routes in place.
+type ErrInvalidRoute struct {
+	Route  string
+	Reason string
+}
+
+func (err ErrInvalidRoute) Error() string {
+	return fmt.Sprintf("invalid route %q: %s", err.Route, err.Reason)
+}
+
+// ErrForward is reported when a message could not be sent to the output of its route.
+// The message is dropped.
+type ErrForward struct {
+	Route string
+	Err   error
+}
+
+func (err ErrForward) Error() string {
+	return fmt.Sprintf("failed to forward message on route %q: %v", err.Route, err.Err)
+}
+
+func (err ErrForward) Unwrap() error { return err.Err }
+
+// Metrics counts the messages handled by a [Router].
+type Metrics struct {
+	Received  uint64
+	Unmatched uint64                  // Dropped without a matching rule or default route.
+	Routes    map[string]RouteMetrics // By route name.
+}
+
+// RouteMetrics counts the messages taken by a route.
+type RouteMetrics struct {
+	Forwarded uint64
+	Failed    uint64 // Dropped after failing to send, see [ErrForward].
+}
+
+// Option represents options that can be applied when creating a [Router].
+type Option interface {
+	applyOption(*Router)
+}
+
+type (
+	optionHeaderParser HeaderParser
+	optionOnError      func(error)
+)
+
+// OptionHeaderParser sets how headers are parsed from messages. Without one, messages have no headers.
+func OptionHeaderParser(parse HeaderParser) Option { return optionHeaderParser(parse) }
+
+// OptionOnError sets a function called with receive errors, header parsing errors and [ErrForward].
+func OptionOnError(fn func(error)) Option { return optionOnError(fn) }
+
+func (opt optionHeaderParser) applyOption(r *Router) { r.parse = HeaderParser(opt) }
+func (opt optionOnError) applyOption(r *Router)      { r.onError = opt }
+
+// Router forwards messages from an input queue to the outputs of its routes.
+type Router struct {
+	in      *posixmq.MQ
+	parse   HeaderParser
+	onError func(error)
+	routes  atomic.Pointer[Routes]
+
+	mu      sync.Mutex
+	metrics Metrics
+}
+
+// NewRouter creates a router receiving from in, which must be opened with [posixmq.OpenReadWrite]
+// so messages can be sent back to it when the router stops, see [Router.Run].
+// [ErrInvalidRoute] is returned if a rule has no matcher or a route has no output.
+func NewRouter(in *posixmq.MQ, routes Routes, opts ...Option) (*Router, error) {
+	if in.Oflag()&(posixmq.OpenWriteOnly|posixmq.OpenReadWrite) != posixmq.OpenReadWrite {
+		return nil, fmt.Errorf("invalid input queue %s, it must be opened with OpenReadWrite", in.Name())
+	}
+
+	r := &Router{in: in, metrics: Metrics{Routes: map[string]RouteMetrics{}}}
+	for _, opt := range opts {
+		opt.applyOption(r)
+	}
+	if err := r.SetRoutes(routes); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetRoutes replaces the routing table. The message being routed, if any, finishes on the old routes,
+// so no message is dropped by the change.
+// [ErrInvalidRoute] is returned if a rule has no matcher or a route has no output.
+func (r *Router) SetRoutes(routes Routes) error {
+	for _, route := range routes.Rules {
+		if route.Match == nil {
+			return ErrInvalidRoute{Route: route.Name, Reason: "the rule has no matcher"}
+		} else if route.Output == nil {
+			return ErrInvalidRoute{Route: route.Name, Reason: "the route has no output"}
+		}
+	}
+	if routes.Default != nil && routes.Default.Output == nil {
+		return ErrInvalidRoute{Route: routes.Default.Name, Reason: "the route has no output"}
+	}
+
+	routes.Rules = append([]Route(nil), routes.Rules...)
+	r.routes.Store(&routes)
+	return nil
+}
+
+// Metrics returns the counts of messages handled so far.
+func (r *Router) Metrics() Metrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := r.metrics
+	m.Routes = make(map[string]RouteMetrics, len(r.metrics.Routes))
+	for name, rm := range r.metrics.Routes {
+		m.Routes[name] = rm
+	}
+	return m
+}
+
+// Run routes messages until ctx is done. Messages are forwarded one at a time in the order they are received,
+// a full output blocks the router until it has room. A message still waiting for room when ctx is done is
+// sent back to the input queue, where it goes behind any messages of the same priority that arrived meanwhile.
+func (r *Router) Run(ctx context.Context) error {
+	for ctx.Err() == nil {
+		msg, err := r.in.ReceiveMessage(deadline.Step(ctx, deadline.PollInterval))
+		if errors.Is(err, posixmq.ErrSendRecvTimeout{}) {
+			continue
+		} else if err != nil && !errors.Is(err, posixmq.ErrExpiryMissing{}) {
+			r.reportError(err)
+			// Avoid spinning on a persistent error.
+			select {
+			case <-ctx.Done():
+			case <-time.After(deadline.PollInterval):
+			}
+			continue
+		}
+		if err := r.route(ctx, Message{Data: msg.Data, Priority: msg.Priority, ExpiresAt: msg.ExpiresAt}); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// route forwards a message, returning an error only if ctx is done and the message could not be put back.
+func (r *Router) route(ctx context.Context, m Message) error {
+	routes := r.routes.Load()
+	r.count(func(metrics *Metrics) { metrics.Received++ })
+
+	if r.parse != nil {
+		headers, err := r.parse(m.Data)
+		if err != nil {
+			r.reportError(fmt.Errorf("failed to parse message headers: %w", err))
+		}
+		m.Headers = headers
+	}
+
+	route := routes.Default
+	for i := range routes.Rules {
+		if routes.Rules[i].Match(m) {
+			route = &routes.Rules[i]
+			break
+		}
+	}
+	if route == nil {
+		r.count(func(metrics *Metrics) { metrics.Unmatched++ })
+		return nil
+	}
+
+	out := posixmq.Message{Data: m.Data, Priority: m.Priority, ExpiresAt: m.ExpiresAt}
+	if route.Priority != nil {
+		out.Priority = route.Priority(out.Priority)
+	}
+	err := forward(ctx, route.Output, out)
+	if err != nil && ctx.Err() != nil {
+		if err := r.in.SendMessage(deadline.Past, posixmq.Message{Data: m.Data, Priority: m.Priority, ExpiresAt: m.ExpiresAt}); err != nil {
+			return fmt.Errorf("failed to return message on route %q to the input queue: %w", route.Name, err)
+		}
+		return ctx.Err()
+	}
+
+	r.count(func(metrics *Metrics) {
+		rm := metrics.Routes[route.Name]
+		if err != nil {
+			rm.Failed++
+		} else {
+			rm.Forwarded++
+		}
+		metrics.Routes[route.Name] = rm
+	})
+	if err != nil {
+		r.reportError(ErrForward{Route: route.Name, Err: err})
+	}
+	return nil
+}
+
+// forward sends a message to out, waiting for room until ctx is done.
+func forward(ctx context.Context, out *posixmq.MQ, msg posixmq.Message) error {
+	for {
+		err := out.SendMessage(deadline.Step(ctx, deadline.PollInterval), msg)
+		if !errors.Is(err, posixmq.ErrSendRecvTimeout{}) || ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+func (r *Router) count(fn func(*Metrics)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn(&r.metrics)
+}
+
+func (r *Router) reportError(err error) {
+	if r.onError != nil {
+		r.onError(err)
+	}
+}
@@ -0,0 +1,231 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"github.com/bobcatalyst/go-mq/posixmq"
+	"math/rand/v2"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestMQ(t *testing.T) *posixmq.MQ {
+	t.Helper()
+	mq, err := posixmq.New(fmt.Sprintf("/router-%d.tmp", rand.Uint64()),
+		posixmq.OptionCreateArgs(0600, 64, 10),
+		posixmq.OptionOflag(posixmq.OpenReadWrite|posixmq.OpenExclusive),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mq.Unlink() })
+	return mq
+}
+
+// parseHeaders reads "key=value;key=value|body".
+func parseHeaders(data []byte) (map[string]string, error) {
+	head, _, ok := strings.Cut(string(data), "|")
+	if !ok {
+		return nil, nil
+	}
+	headers := map[string]string{}
+	for _, kv := range strings.Split(head, ";") {
+		k, v, _ := strings.Cut(kv, "=")
+		headers[k] = v
+	}
+	return headers, nil
+}
+
+func expectMessages(t *testing.T, mq *posixmq.MQ, expected ...string) {
+	t.Helper()
+	for _, e := range expected {
+		data, priority, err := mq.Receive(deadline.TimeDeadline(time.Now().Add(time.Second * 2)))
+		if err != nil {
+			t.Fatalf("expected %q on %s: %v", e, mq.Name(), err)
+		} else if got := fmt.Sprintf("%s@%d", data, priority); got != e {
+			t.Fatalf("expected %q on %s, got %q", e, mq.Name(), got)
+		}
+	}
+	if data, _, err := mq.Receive(deadline.TimeDeadline(time.Unix(0, 1))); err == nil {
+		t.Fatalf("unexpected message %q on %s", data, mq.Name())
+	}
+}
+
+func TestRouter(t *testing.T) {
+	in, a, b, def := newTestMQ(t), newTestMQ(t), newTestMQ(t), newTestMQ(t)
+	r, err := NewRouter(in, Routes{
+		Rules: []Route{
+			{Name: "header", Match: HeaderEquals("type", "order"), Output: a},
+			{Name: "prefix", Match: PayloadPrefix([]byte("A:")), Output: a, Priority: FixedPriority(9)},
+			{Name: "regexp", Match: PayloadRegexp(regexp.MustCompile(`^\d+$`)), Output: b},
+			{Name: "priority", Match: PriorityRange(5, 7), Output: b},
+			{Name: "predicate", Match: func(m Message) bool { return len(m.Data) > 20 }, Output: b},
+		},
+		Default: &Route{Name: "default", Output: def},
+	}, OptionHeaderParser(parseHeaders))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- r.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	for _, m := range []struct {
+		data     string
+		priority uint
+	}{
+		{"type=order|x", 0},
+		{"A:first", 1},
+		{"12345", 0},
+		{"urgent", 6},
+		{"a long message for the predicate", 0},
+		{"other", 0},
+	} {
+		if err := in.Send(t, []byte(m.data), m.priority); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expectMessages(t, a, "A:first@9", "type=order|x@0")
+	expectMessages(t, b, "urgent@6", "12345@0", "a long message for the predicate@0")
+	expectMessages(t, def, "other@0")
+
+	// Messages sent after the routes change take the new routes.
+	if err := r.SetRoutes(Routes{Rules: []Route{{Name: "all", Match: PriorityRange(0, 100), Output: def}}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range []string{"A:second", "no default"} {
+		if err := in.Send(t, []byte(data), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectMessages(t, def, "A:second@0", "no default@0")
+
+	if err := r.SetRoutes(Routes{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Send(t, []byte("dropped"), 0); err != nil {
+		t.Fatal(err)
+	}
+	for start := time.Now(); r.Metrics().Unmatched == 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second*2 {
+			t.Fatal("message was not routed")
+		}
+	}
+
+	m := r.Metrics()
+	if m.Received != 9 || m.Unmatched != 1 {
+		t.Fatalf("unexpected metrics %+v", m)
+	}
+	for name, forwarded := range map[string]uint64{"header": 1, "prefix": 1, "regexp": 1, "priority": 1, "predicate": 1, "default": 1, "all": 2} {
+		if rm := m.Routes[name]; rm.Forwarded != forwarded || rm.Failed != 0 {
+			t.Fatalf("route %s: expected %d forwarded, got %+v", name, forwarded, rm)
+		}
+	}
+}
+
+func TestRouter_ReturnOnCancel(t *testing.T) {
+	in, out := newTestMQ(t), newTestMQ(t)
+	for i := range 10 {
+		if err := out.Send(t, []byte{byte(i)}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := in.Send(t, []byte("waiting"), 3); err != nil {
+		t.Fatal(err)
+	}
+
+	// The output is full, so the message is sent back to the input when the router stops.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	r, err := NewRouter(in, Routes{Default: &Route{Name: "full", Output: out}})
+	if err != nil {
+		t.Fatal(err)
+	} else if err := r.Run(ctx); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	expectMessages(t, in, "waiting@3")
+}
+
+func TestRouter_Expiry(t *testing.T) {
+	var queues []*posixmq.MQ
+	for range 2 {
+		mq, err := posixmq.New(fmt.Sprintf("/router-%d.tmp", rand.Uint64()),
+			posixmq.OptionCreateArgs(0600, 64, 10),
+			posixmq.OptionOflag(posixmq.OpenReadWrite|posixmq.OpenExclusive),
+			posixmq.OptionExpiry(false, nil),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { mq.Unlink() })
+		queues = append(queues, mq)
+	}
+	in, out := queues[0], queues[1]
+
+	expiresAt := time.Now().Add(time.Hour).Round(0)
+	if err := in.Send(t, []byte("ttl"), 0, posixmq.SendExpiresAt(expiresAt)); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	r, err := NewRouter(in, Routes{Default: &Route{Name: "out", Output: out}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Run(ctx)
+
+	if msg, err := out.ReceiveMessage(t); err != nil {
+		t.Fatal(err)
+	} else if !msg.ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("expected the routed message to expire at %s, got %s", expiresAt, msg.ExpiresAt)
+	}
+}
+
+func TestRouter_InvalidRoutes(t *testing.T) {
+	in, out := newTestMQ(t), newTestMQ(t)
+	for _, test := range []struct {
+		name   string
+		routes Routes
+	}{
+		{name: "no matcher", routes: Routes{Rules: []Route{{Name: "nil", Output: out}}}},
+		{name: "no output", routes: Routes{Rules: []Route{{Name: "nil", Match: PriorityRange(0, 1)}}}},
+		{name: "no default output", routes: Routes{Default: &Route{Name: "nil"}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var invalid ErrInvalidRoute
+			if _, err := NewRouter(in, test.routes); !errors.As(err, &invalid) || invalid.Route != "nil" {
+				t.Fatalf("expected ErrInvalidRoute, got %v", err)
+			}
+		})
+	}
+
+	// The input must be writable, so messages can be sent back to it.
+	readOnly, err := posixmq.New(in.Name(), posixmq.OptionOflag(posixmq.OpenReadOnly))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readOnly.Close()
+	if _, err := NewRouter(readOnly, Routes{Default: &Route{Name: "out", Output: out}}); err == nil {
+		t.Fatal("expected an error for a read-only input")
+	}
+
+	// Invalid routes leave the previous routes in place.
+	r, err := NewRouter(in, Routes{Default: &Route{Name: "out", Output: out}})
+	if err != nil {
+		t.Fatal(err)
+	} else if err := r.SetRoutes(Routes{Rules: []Route{{Name: "nil", Output: out}}}); err == nil {
+		t.Fatal("expected an error")
+	} else if routes := r.routes.Load(); routes.Default == nil || routes.Default.Name != "out" {
+		t.Fatalf("expected the previous routes to be kept, got %+v", routes)
+	}
+}
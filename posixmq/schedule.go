@@ -0,0 +1,339 @@
+package posixmq
+
+import (
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ScheduleID identifies a message held by a [Scheduler].
+type ScheduleID uint64
+
+// ErrSchedulerClosed is returned when scheduling on a [Scheduler] that has been closed.
+type ErrSchedulerClosed struct{}
+
+func (ErrSchedulerClosed) Error() string {
+	return "the scheduler has been closed"
+}
+
+// SchedulerOption represents options that can be applied when creating a [Scheduler].
+type SchedulerOption interface {
+	applySchedulerOption(*Scheduler)
+}
+
+type (
+	schedulePersist     string
+	scheduleOnError     func(ScheduleID, error)
+	scheduleSendTimeout time.Duration
+)
+
+// SchedulePersist stores pending messages in the file at path so they survive a restart.
+// Pending messages found in the file are loaded when the [Scheduler] is created.
+func SchedulePersist(path string) SchedulerOption { return schedulePersist(path) }
+
+// ScheduleOnError sets a function that is called when a due message could not be sent.
+func ScheduleOnError(fn func(ScheduleID, error)) SchedulerOption { return scheduleOnError(fn) }
+
+// ScheduleSendTimeout sets how long a due message may block on a full queue before it is retried.
+func ScheduleSendTimeout(d time.Duration) SchedulerOption { return scheduleSendTimeout(d) }
+
+func (opt schedulePersist) applySchedulerOption(s *Scheduler)     { s.path = string(opt) }
+func (opt scheduleOnError) applySchedulerOption(s *Scheduler)     { s.onError = opt }
+func (opt scheduleSendTimeout) applySchedulerOption(s *Scheduler) { s.sendTimeout = time.Duration(opt) }
+
+// Scheduler holds messages and releases them into a queue once they are due.
+//
+// Due times are tracked using the monotonic clock, so wall clock jumps after a message
+// has been scheduled do not change when it is released.
+// Only the wall clock time is persisted, so messages loaded from disk are due relative to the wall clock at load time.
+type Scheduler struct {
+	mq          *MQ
+	path        string
+	onError     func(ScheduleID, error)
+	sendTimeout time.Duration
+
+	mu       sync.Mutex
+	nextID   ScheduleID
+	pending  map[ScheduleID]*scheduled
+	queue    scheduledQueue
+	inflight *scheduled // Message currently being sent, still persisted until the send completes.
+	closed   bool
+
+	wake chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// scheduled is a single message waiting to be released.
+type scheduled struct {
+	ID       ScheduleID `json:"id"`
+	At       time.Time  `json:"at"` // Wall clock due time, used for persistence.
+	Data     []byte     `json:"data"`
+	Priority uint       `json:"priority"`
+
+	due   time.Time // Due time with a monotonic clock reading.
+	index int       // Index in the scheduledQueue.
+}
+
+// NewScheduler creates a scheduler releasing messages into mq.
+func NewScheduler(mq *MQ, opts ...SchedulerOption) (*Scheduler, error) {
+	s := &Scheduler{
+		mq:          mq,
+		sendTimeout: time.Second,
+		nextID:      1,
+		pending:     map[ScheduleID]*scheduled{},
+		wake:        make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt.applySchedulerOption(s)
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	s.wg.Add(1)
+	go s.run()
+	return s, nil
+}
+
+// SendAt schedules data to be sent with priority at t.
+func (s *Scheduler) SendAt(t time.Time, data []byte, priority uint) (ScheduleID, error) {
+	return s.schedule(t, time.Until(t), data, priority)
+}
+
+// SendAfter schedules data to be sent with priority once d has elapsed.
+func (s *Scheduler) SendAfter(d time.Duration, data []byte, priority uint) (ScheduleID, error) {
+	return s.schedule(time.Now().Add(d), d, data, priority)
+}
+
+func (s *Scheduler) schedule(at time.Time, d time.Duration, data []byte, priority uint) (ScheduleID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, ErrSchedulerClosed{}
+	}
+
+	msg := &scheduled{
+		ID:       s.nextID,
+		At:       at.Round(0),
+		Data:     append([]byte(nil), data...),
+		Priority: priority,
+		due:      time.Now().Add(d),
+	}
+	s.nextID++
+	s.add(msg)
+	if err := s.persist(); err != nil {
+		s.remove(msg)
+		return 0, err
+	}
+	s.signal()
+	return msg.ID, nil
+}
+
+// Cancel removes a pending message. Returns false if the message was already released or does not exist.
+func (s *Scheduler) Cancel(id ScheduleID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg, ok := s.pending[id]
+	if !ok {
+		return false, nil
+	}
+	s.remove(msg)
+	s.signal()
+	return true, s.persist()
+}
+
+// Pending returns the number of messages that have not been released yet.
+func (s *Scheduler) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+// Close stops releasing messages.
+// Pending messages are kept on disk if [SchedulePersist] was used, otherwise they are discarded.
+func (s *Scheduler) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+// run releases messages as they become due until the scheduler is closed.
+func (s *Scheduler) run() {
+	defer s.wg.Done()
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		s.releaseDue()
+
+		var expired <-chan time.Time
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			timer.Reset(time.Until(s.queue[0].due))
+			expired = timer.C
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		case <-expired:
+		}
+	}
+}
+
+// releaseDue sends every message whose due time has passed.
+// A message is removed from the pending set before it is sent, and only put back if the queue was full.
+func (s *Scheduler) releaseDue() {
+	for {
+		s.mu.Lock()
+		if s.closed || len(s.queue) == 0 || time.Until(s.queue[0].due) > 0 {
+			s.mu.Unlock()
+			return
+		}
+		msg := s.queue[0]
+		s.remove(msg)
+		s.inflight = msg
+		s.mu.Unlock()
+
+		err := s.mq.Send(deadline.TimeDeadline(time.Now().Add(s.sendTimeout)), msg.Data, msg.Priority)
+
+		s.mu.Lock()
+		s.inflight = nil
+		if errors.Is(err, ErrSendRecvTimeout{}) || errors.Is(err, ErrSendFullQueue{}) || errors.Is(err, ErrSendRecvInterrupted{}) {
+			// The queue is full, try again later without losing the message.
+			msg.due = time.Now().Add(s.sendTimeout)
+			s.add(msg)
+			s.mu.Unlock()
+			return
+		}
+		// Only persist after sending, a crash in between will send the message again instead of losing it.
+		perr := s.persist()
+		s.mu.Unlock()
+
+		if err = errors.Join(err, perr); err != nil && s.onError != nil {
+			s.onError(msg.ID, err)
+		}
+	}
+}
+
+// signal wakes the run loop so it can recalculate the next due time.
+func (s *Scheduler) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) add(msg *scheduled) {
+	s.pending[msg.ID] = msg
+	heap.Push(&s.queue, msg)
+}
+
+func (s *Scheduler) remove(msg *scheduled) {
+	delete(s.pending, msg.ID)
+	heap.Remove(&s.queue, msg.index)
+}
+
+// load reads pending messages from the persistence file, if one is set.
+func (s *Scheduler) load() error {
+	if s.path == "" {
+		return nil
+	}
+
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var msgs []*scheduled
+	if err := json.Unmarshal(b, &msgs); err != nil {
+		return fmt.Errorf("failed to load scheduled messages from %q: %w", s.path, err)
+	}
+	for _, msg := range msgs {
+		msg.due = time.Now().Add(time.Until(msg.At))
+		s.add(msg)
+		s.nextID = max(s.nextID, msg.ID+1)
+	}
+	return nil
+}
+
+// persist writes all pending messages to the persistence file, if one is set.
+// The file is replaced atomically so a crash never leaves a partial file behind.
+func (s *Scheduler) persist() error {
+	if s.path == "" {
+		return nil
+	}
+
+	msgs := make([]*scheduled, 0, len(s.queue)+1)
+	msgs = append(msgs, s.queue...)
+	if s.inflight != nil {
+		msgs = append(msgs, s.inflight)
+	}
+	b, err := json.Marshal(msgs)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		return errors.Join(err, tmp.Close())
+	} else if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// scheduledQueue is a min-heap of messages ordered by due time.
+type scheduledQueue []*scheduled
+
+func (q scheduledQueue) Len() int { return len(q) }
+func (q scheduledQueue) Less(i, j int) bool {
+	if q[i].due.Equal(q[j].due) {
+		return q[i].ID < q[j].ID
+	}
+	return q[i].due.Before(q[j].due)
+}
+func (q scheduledQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+func (q *scheduledQueue) Push(x any) {
+	msg := x.(*scheduled)
+	msg.index = len(*q)
+	*q = append(*q, msg)
+}
+func (q *scheduledQueue) Pop() any {
+	old := *q
+	msg := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	msg.index = -1
+	return msg
+}
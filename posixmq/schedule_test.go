@@ -0,0 +1,88 @@
+package posixmq
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMQ_SendAfter(t *testing.T) {
+	mq, err := New(randName(), OptionCreateArgs(0644, 8, 4), OptionOflag(OpenReadWrite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mq.Unlink()
+
+	if _, err := mq.SendAfter(time.Millisecond*50, []byte{1}, 1); err != nil {
+		t.Fatal(err)
+	}
+	id, err := mq.SendAfter(time.Hour, []byte{2}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attr, err := mq.GetAttr()
+	if err != nil {
+		t.Fatal(err)
+	} else if attr.NumCurrMessages != 0 {
+		t.Fatalf("expected no messages before due, got %d", attr.NumCurrMessages)
+	}
+
+	data, prio, err := mq.Receive(t)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(data) != 1 || data[0] != 1 || prio != 1 {
+		t.Fatalf("unexpected message %v with priority %d", data, prio)
+	}
+
+	s, err := mq.Scheduler()
+	if err != nil {
+		t.Fatal(err)
+	} else if n := s.Pending(); n != 1 {
+		t.Fatalf("expected 1 pending message, got %d", n)
+	}
+	if ok, err := s.Cancel(id); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatal("expected message to be cancelled")
+	}
+	if n := s.Pending(); n != 0 {
+		t.Fatalf("expected no pending messages, got %d", n)
+	}
+}
+
+func TestScheduler_Persist(t *testing.T) {
+	mq, err := New(randName(), OptionCreateArgs(0644, 8, 4), OptionOflag(OpenReadWrite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mq.Unlink()
+
+	path := filepath.Join(t.TempDir(), "scheduled.json")
+	s, err := NewScheduler(mq, SchedulePersist(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SendAt(time.Now().Add(time.Millisecond*100), []byte{3}, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewScheduler(mq, SchedulePersist(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if n := s.Pending(); n != 1 {
+		t.Fatalf("expected 1 pending message after reload, got %d", n)
+	}
+
+	data, prio, err := mq.Receive(t)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(data) != 1 || data[0] != 3 || prio != 3 {
+		t.Fatalf("unexpected message %v with priority %d", data, prio)
+	}
+}
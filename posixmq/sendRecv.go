@@ -125,17 +125,17 @@ func RawSendReceive[P uint | *uint](mqd int, dl deadline.Deadline, buf []byte, p
 	case uint:
 		// Sending a message to the queue.
 		return 0, sysSend.Call(
-			uintptr(mqd),                     // mqdes
-			uintptr(unsafe.Pointer(&buf[0])), // msg_ptr
-			uintptr(len(buf)),                // msg_len
-			uintptr(priority),                // msg_prio
-			uintptr(unsafe.Pointer(t)),       // abs_timeout
+			uintptr(mqd), // mqdes
+			uintptr(unsafe.Pointer(unsafe.SliceData(buf))), // msg_ptr
+			uintptr(len(buf)),          // msg_len
+			uintptr(priority),          // msg_prio
+			uintptr(unsafe.Pointer(t)), // abs_timeout
 		)
 	case *uint:
 		// Receiving a message from the queue.
 		return sysRecv.CallValue(
-			uintptr(mqd),                      // mqdes
-			uintptr(unsafe.Pointer(&buf[0])),  // msg_ptr
+			uintptr(mqd), // mqdes
+			uintptr(unsafe.Pointer(unsafe.SliceData(buf))), // msg_ptr
 			uintptr(len(buf)),                 // msg_len
 			uintptr(unsafe.Pointer(priority)), // msg_prio
 			uintptr(unsafe.Pointer(t)),        // abs_timeout
@@ -0,0 +1,185 @@
+package posixmq
+
+import (
+	"fmt"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"io"
+	"time"
+)
+
+// Each message of a stream starts with a frame type.
+const (
+	frameData byte = iota // The rest of the message is stream data.
+	frameEOF              // The writer closed the stream.
+)
+
+// ErrStreamClosed is returned when writing to a [Writer] that has been closed.
+type ErrStreamClosed struct{}
+
+func (ErrStreamClosed) Error() string {
+	return "the stream has been closed"
+}
+
+// ErrInvalidFrame is returned by a [Reader] when it receives a message that was not written by a [Writer].
+type ErrInvalidFrame struct {
+	Size int
+}
+
+func (err ErrInvalidFrame) Error() string {
+	return fmt.Sprintf("received a message of %d bytes that is not a stream frame", err.Size)
+}
+
+// StreamOption represents options that can be applied when creating a [Writer].
+type StreamOption interface {
+	applyStreamOption(*streamConfig)
+}
+
+type streamConfig struct {
+	priority uint
+}
+
+type streamPriority uint
+
+// StreamPriority sets the priority a [Writer] sends messages with, default 0.
+// A stream must be written with a single priority, or its data is reordered.
+func StreamPriority(priority uint) StreamOption { return streamPriority(priority) }
+
+func (opt streamPriority) applyStreamOption(c *streamConfig) { c.priority = uint(opt) }
+
+// Writer frames a byte stream into messages no larger than the queue's MaxMessageSize.
+// Each Write sends at least one message, so wrap it in a [bufio.Writer] for many small writes.
+// The queue must only be read by a single [Reader].
+type Writer struct {
+	mq       *MQ
+	priority uint
+	dl       deadline.Deadline
+	frame    []byte // Scratch buffer for a frame, sized to the queue's MaxMessageSize.
+	closed   bool
+}
+
+// NewWriter creates a writer sending to mq.
+func NewWriter(mq *MQ, opts ...StreamOption) *Writer {
+	var c streamConfig
+	for _, opt := range opts {
+		opt.applyStreamOption(&c)
+	}
+	return &Writer{mq: mq, priority: c.priority, dl: deadline.NoDeadline{}}
+}
+
+// SetDeadline sets the deadline for future writes, the zero time means writes block while the queue is full.
+// A write reaching the deadline returns [ErrSendRecvTimeout].
+func (w *Writer) SetDeadline(t time.Time) error {
+	w.dl = deadline.TimeDeadline(t)
+	return nil
+}
+
+// Write sends p as one or more data frames.
+func (w *Writer) Write(p []byte) (n int, err error) {
+	if w.closed {
+		return 0, ErrStreamClosed{}
+	} else if w.frame == nil {
+		if w.frame, err = streamBuffer(w.mq); err != nil {
+			return 0, err
+		}
+	}
+
+	for len(p) > 0 {
+		chunk := p[:min(len(p), len(w.frame)-1)]
+		w.frame[0] = frameData
+		copy(w.frame[1:], chunk)
+		if err := w.mq.Send(w.dl, w.frame[:1+len(chunk)], w.priority); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// Close sends the end of stream marker, after which the reader returns [io.EOF].
+// The queue itself is left open.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	} else if err := w.mq.Send(w.dl, []byte{frameEOF}, w.priority); err != nil {
+		return err
+	}
+	w.closed = true
+	return nil
+}
+
+// Reader reassembles a byte stream written by a [Writer].
+type Reader struct {
+	mq   *MQ
+	dl   deadline.Deadline
+	buf  []byte // Receive buffer, sized to the queue's MaxMessageSize.
+	rest []byte // Data from the last frame not yet read.
+	eof  bool
+}
+
+// NewReader creates a reader receiving from mq.
+func NewReader(mq *MQ) *Reader {
+	return &Reader{mq: mq, dl: deadline.NoDeadline{}}
+}
+
+// SetDeadline sets the deadline for future reads, the zero time means reads block until data arrives.
+// A read reaching the deadline returns [ErrSendRecvTimeout].
+func (r *Reader) SetDeadline(t time.Time) error {
+	r.dl = deadline.TimeDeadline(t)
+	return nil
+}
+
+// Read reads stream data, receiving the next frame when data from the last one has been read.
+// Once the end of stream marker is received, [io.EOF] is returned.
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.rest) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		} else if len(p) == 0 {
+			return 0, nil
+		} else if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.rest)
+	r.rest = r.rest[n:]
+	return n, nil
+}
+
+// next receives the next frame.
+func (r *Reader) next() error {
+	if r.buf == nil {
+		buf, err := streamBuffer(r.mq)
+		if err != nil {
+			return err
+		}
+		r.buf = buf
+	}
+
+	data, _, err := r.mq.receiveInto(r.dl, r.buf)
+	if err != nil {
+		return err
+	} else if len(data) == 0 {
+		return ErrInvalidFrame{Size: 0}
+	}
+	switch data[0] {
+	case frameData:
+		r.rest = data[1:]
+	case frameEOF:
+		r.eof = true
+	default:
+		return ErrInvalidFrame{Size: len(data)}
+	}
+	return nil
+}
+
+// streamBuffer allocates a buffer for a whole message of mq, which must fit a frame type and some data.
+func streamBuffer(mq *MQ) ([]byte, error) {
+	attr, err := mq.GetAttr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message buffer size from attributes: %w", err)
+	} else if attr.MaxMessageSize < 2 {
+		return nil, fmt.Errorf("invalid MaxMessageSize of %d, a stream needs at least 2", attr.MaxMessageSize)
+	}
+	return make([]byte, attr.MaxMessageSize), nil
+}
@@ -0,0 +1,94 @@
+package posixmq
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+func TestStream(t *testing.T) {
+	mq, err := New(randName(), OptionCreateArgs(0644, 16, 4), OptionOflag(OpenReadWrite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mq.Unlink()
+
+	// Much larger than a message, so it is split into many frames.
+	expected := make([]byte, 1000)
+	for i := range expected {
+		expected[i] = byte(rand.N(256))
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		w := NewWriter(mq, StreamPriority(3))
+		if _, err := io.Copy(w, bytes.NewReader(expected)); err != nil {
+			errc <- err
+			return
+		}
+		errc <- w.Close()
+	}()
+
+	got, err := io.ReadAll(NewReader(mq))
+	if err != nil {
+		t.Fatal(err)
+	} else if err := <-errc; err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(got, expected) {
+		t.Fatal("stream data does not match")
+	}
+}
+
+func TestStream_JSON(t *testing.T) {
+	mq, err := New(randName(), OptionCreateArgs(0644, 8, 10), OptionOflag(OpenReadWrite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mq.Unlink()
+
+	type value struct{ A, B string }
+	expected := value{A: "hello", B: "world"}
+	w := NewWriter(mq)
+	errc := make(chan error, 1)
+	go func() {
+		if err := json.NewEncoder(w).Encode(expected); err != nil {
+			errc <- err
+			return
+		}
+		errc <- w.Close()
+	}()
+
+	var got value
+	if err := json.NewDecoder(NewReader(mq)).Decode(&got); err != nil {
+		t.Fatal(err)
+	} else if err := <-errc; err != nil {
+		// The writer must be done before the queue is closed, or its descriptor may be reused by another test.
+		t.Fatal(err)
+	} else if got != expected {
+		t.Fatalf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestReader_Deadline(t *testing.T) {
+	mq, err := New(randName(), OptionCreateArgs(0644, 4, 1), OptionOflag(OpenReadWrite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mq.Unlink()
+
+	r := NewReader(mq)
+	r.SetDeadline(time.Now().Add(time.Millisecond * 10))
+	if _, err := r.Read(make([]byte, 1)); !errors.Is(err, ErrSendRecvTimeout{}) {
+		t.Fatalf("expected ErrSendRecvTimeout, got %v", err)
+	}
+
+	if err := mq.Send(t, []byte{0xfe}, 0); err != nil {
+		t.Fatal(err)
+	} else if _, err := r.Read(make([]byte, 1)); !errors.As(err, new(ErrInvalidFrame)) {
+		t.Fatalf("expected ErrInvalidFrame, got %v", err)
+	}
+}
@@ -0,0 +1,269 @@
+package posixmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bobcatalyst/go-mq/internal/deadline"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Handler processes a single message received by a [WorkerPool].
+// data is only valid for the duration of the call.
+type Handler func(ctx context.Context, data []byte, priority uint) error
+
+// ErrHandlerPanic is reported when a [Handler] panics.
+type ErrHandlerPanic struct {
+	Value any    // Value passed to panic.
+	Stack []byte // Stack trace of the panicking goroutine.
+}
+
+func (err ErrHandlerPanic) Error() string {
+	return fmt.Sprintf("handler panicked: %v", err.Value)
+}
+
+// ErrWorkerPoolStopped is returned when shutting down a [WorkerPool] that was already shut down.
+type ErrWorkerPoolStopped struct{}
+
+func (ErrWorkerPoolStopped) Error() string {
+	return "the worker pool has already been shut down"
+}
+
+// WorkerPoolOption represents options that can be applied when creating a [WorkerPool].
+type WorkerPoolOption interface {
+	applyWorkerPoolOption(*WorkerPool)
+}
+
+type (
+	workerPoolSize          struct{ min, max int }
+	workerPoolIdleTimeout   time.Duration
+	workerPoolPollInterval  time.Duration
+	workerPoolScaleInterval time.Duration
+	workerPoolOnError       func(error)
+)
+
+// WorkerPoolSize sets the minimum and maximum number of workers. Defaults to 1 and 1.
+func WorkerPoolSize(min, max int) WorkerPoolOption { return workerPoolSize{min: min, max: max} }
+
+// WorkerPoolIdleTimeout sets how long a worker above the minimum may go without a message before it exits.
+func WorkerPoolIdleTimeout(d time.Duration) WorkerPoolOption { return workerPoolIdleTimeout(d) }
+
+// WorkerPoolPollInterval sets how long a worker blocks on receive before checking for shutdown.
+func WorkerPoolPollInterval(d time.Duration) WorkerPoolOption { return workerPoolPollInterval(d) }
+
+// WorkerPoolScaleInterval sets how often the queue depth is checked to decide if workers should be added.
+func WorkerPoolScaleInterval(d time.Duration) WorkerPoolOption { return workerPoolScaleInterval(d) }
+
+// WorkerPoolOnError sets a function called with handler errors, recovered panics as [ErrHandlerPanic], and receive errors.
+// Messages received with [ErrExpiryMissing] are still handled, after the error is reported.
+func WorkerPoolOnError(fn func(error)) WorkerPoolOption { return workerPoolOnError(fn) }
+
+func (opt workerPoolSize) applyWorkerPoolOption(p *WorkerPool) { p.min, p.max = opt.min, opt.max }
+func (opt workerPoolIdleTimeout) applyWorkerPoolOption(p *WorkerPool) {
+	p.idleTimeout = time.Duration(opt)
+}
+func (opt workerPoolPollInterval) applyWorkerPoolOption(p *WorkerPool) {
+	p.pollInterval = time.Duration(opt)
+}
+func (opt workerPoolScaleInterval) applyWorkerPoolOption(p *WorkerPool) {
+	p.scaleInterval = time.Duration(opt)
+}
+func (opt workerPoolOnError) applyWorkerPoolOption(p *WorkerPool) { p.onError = opt }
+
+// WorkerPool receives messages from a queue and dispatches them to a [Handler].
+// Workers are added while the queue depth exceeds the number of workers, and removed again once idle.
+type WorkerPool struct {
+	mq            *MQ
+	handler       Handler
+	min, max      int
+	idleTimeout   time.Duration
+	pollInterval  time.Duration
+	scaleInterval time.Duration
+	onError       func(error)
+	bufSize       int
+
+	ctx    context.Context    // Passed to handlers, cancelled if shutdown is forced.
+	cancel context.CancelFunc // Cancels ctx.
+	done   chan struct{}      // Closed when the pool starts shutting down.
+
+	mu       sync.Mutex
+	workers  int
+	stopping bool
+	wg       sync.WaitGroup
+}
+
+// NewWorkerPool starts receiving from mq and dispatching messages to handler.
+// mq should be opened in blocking mode for reading.
+func NewWorkerPool(mq *MQ, handler Handler, opts ...WorkerPoolOption) (*WorkerPool, error) {
+	p := &WorkerPool{
+		mq:            mq,
+		handler:       handler,
+		min:           1,
+		max:           1,
+		idleTimeout:   time.Second * 30,
+		pollInterval:  time.Millisecond * 250,
+		scaleInterval: time.Second,
+		done:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt.applyWorkerPoolOption(p)
+	}
+	if p.min < 0 || p.max < 1 || p.min > p.max {
+		return nil, fmt.Errorf("invalid worker pool size, min %d max %d", p.min, p.max)
+	}
+
+	attr, err := mq.GetAttr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message buffer size from attributes: %w", err)
+	}
+	p.bufSize = attr.MaxMessageSize
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+
+	p.mu.Lock()
+	p.spawn(p.min)
+	p.mu.Unlock()
+
+	p.wg.Add(1)
+	go p.scale()
+	return p, nil
+}
+
+// Workers returns the current number of workers.
+func (p *WorkerPool) Workers() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.workers
+}
+
+// Shutdown stops receiving messages, waits for in-flight handlers to finish, and then closes the queue.
+// If ctx is done first, the context passed to handlers is cancelled and ctx.Err() is returned without closing the queue.
+func (p *WorkerPool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if p.stopping {
+		p.mu.Unlock()
+		return ErrWorkerPoolStopped{}
+	}
+	p.stopping = true
+	close(p.done)
+	p.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		p.cancel()
+		return p.mq.Close()
+	case <-ctx.Done():
+		p.cancel()
+		return ctx.Err()
+	}
+}
+
+// spawn starts n workers. p.mu must be held.
+func (p *WorkerPool) spawn(n int) {
+	for range n {
+		p.workers++
+		p.wg.Add(1)
+		go p.work()
+	}
+}
+
+// retire removes a worker if the pool is above its minimum size.
+func (p *WorkerPool) retire() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.workers > p.min {
+		p.workers--
+		return true
+	}
+	return false
+}
+
+// scale adds workers while the queue depth exceeds the number of workers.
+func (p *WorkerPool) scale() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.scaleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+
+		attr, err := p.mq.GetAttr()
+		if err != nil {
+			p.report(err)
+			continue
+		}
+
+		p.mu.Lock()
+		if !p.stopping && attr.NumCurrMessages > p.workers {
+			p.spawn(min(attr.NumCurrMessages, p.max) - p.workers)
+		}
+		p.mu.Unlock()
+	}
+}
+
+// work receives and handles messages until the pool is shut down or the worker is retired.
+func (p *WorkerPool) work() {
+	defer p.wg.Done()
+	buf := make([]byte, p.bufSize)
+	idleSince := time.Now()
+	for {
+		select {
+		case <-p.done:
+			p.mu.Lock()
+			p.workers--
+			p.mu.Unlock()
+			return
+		default:
+		}
+
+		data, priority, err := p.mq.receiveInto(deadline.TimeDeadline(time.Now().Add(p.pollInterval)), buf)
+		switch {
+		case errors.Is(err, ErrSendRecvTimeout{}), errors.Is(err, ErrRecvEmptyQueue{}), errors.Is(err, ErrSendRecvInterrupted{}):
+			if time.Since(idleSince) >= p.idleTimeout && p.retire() {
+				return
+			} else if errors.Is(err, ErrRecvEmptyQueue{}) {
+				// Non-blocking queues return immediately, avoid spinning.
+				time.Sleep(p.pollInterval)
+			}
+		case errors.Is(err, ErrExpiryMissing{}):
+			// The message was already dequeued, so it is handled rather than dropped.
+			p.report(err)
+			p.handle(data, priority)
+			idleSince = time.Now()
+		case err != nil:
+			p.report(err)
+			time.Sleep(p.pollInterval)
+		default:
+			p.handle(data, priority)
+			idleSince = time.Now()
+		}
+	}
+}
+
+// handle calls the handler, recovering and reporting any panic.
+func (p *WorkerPool) handle(data []byte, priority uint) {
+	defer func() {
+		if v := recover(); v != nil {
+			p.report(ErrHandlerPanic{Value: v, Stack: debug.Stack()})
+		}
+	}()
+	if err := p.handler(p.ctx, data, priority); err != nil {
+		p.report(err)
+	}
+}
+
+func (p *WorkerPool) report(err error) {
+	if p.onError != nil {
+		p.onError(err)
+	}
+}
@@ -0,0 +1,126 @@
+package posixmq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerPool(t *testing.T) {
+	const messages = 8
+	name := randName()
+	mq, err := New(name, OptionCreateArgs(0644, 1, messages), OptionOflag(OpenReadWrite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RawUnlink(name)
+
+	var handled atomic.Int32
+	var wg sync.WaitGroup
+	wg.Add(messages)
+	release := make(chan struct{})
+	var errs []error
+	var errsMu sync.Mutex
+
+	for i := range messages {
+		if err := mq.Send(t, []byte{byte(i)}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := NewWorkerPool(mq, func(_ context.Context, data []byte, _ uint) error {
+		defer wg.Done()
+		<-release
+		handled.Add(1)
+		if data[0] == 0 {
+			panic("boom")
+		}
+		return nil
+	},
+		WorkerPoolSize(1, 4),
+		WorkerPoolIdleTimeout(time.Millisecond*50),
+		WorkerPoolPollInterval(time.Millisecond*10),
+		WorkerPoolScaleInterval(time.Millisecond*10),
+		WorkerPoolOnError(func(err error) {
+			errsMu.Lock()
+			defer errsMu.Unlock()
+			errs = append(errs, err)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// All workers block in the handler, so the backlog should scale the pool up to its maximum.
+	for start := time.Now(); p.Workers() < 4; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second*5 {
+			t.Fatalf("expected pool to scale to 4 workers, got %d", p.Workers())
+		}
+	}
+	close(release)
+	wg.Wait()
+
+	// Idle workers should retire back down to the minimum.
+	for start := time.Now(); p.Workers() > 1; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second*5 {
+			t.Fatalf("expected pool to shrink to 1 worker, got %d", p.Workers())
+		}
+	}
+
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n := handled.Load(); n != messages {
+		t.Fatalf("expected %d messages handled, got %d", messages, n)
+	} else if len(errs) != 1 || !errors.As(errs[0], new(ErrHandlerPanic)) {
+		t.Fatalf("expected a single handler panic, got %v", errs)
+	}
+	if err := p.Shutdown(context.Background()); !errors.Is(err, ErrWorkerPoolStopped{}) {
+		t.Fatalf("expected ErrWorkerPoolStopped, got %v", err)
+	}
+}
+
+func TestWorkerPool_ExpiryMissing(t *testing.T) {
+	mq, err := New(randName(), OptionCreateArgs(0644, 32, 4), OptionOflag(OpenReadWrite), OptionExpiry(true, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mq.Unlink()
+
+	if err := mq.Send(t, []byte("plain"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	handled := make(chan string, 1)
+	reported := make(chan error, 1)
+	p, err := NewWorkerPool(mq, func(_ context.Context, data []byte, _ uint) error {
+		handled <- string(data)
+		return nil
+	},
+		WorkerPoolPollInterval(time.Millisecond*10),
+		WorkerPoolOnError(func(err error) { reported <- err }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Shutdown(context.Background())
+
+	select {
+	case err := <-reported:
+		if !errors.Is(err, ErrExpiryMissing{}) {
+			t.Fatalf("expected ErrExpiryMissing, got %v", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected the missing expiry to be reported")
+	}
+	select {
+	case data := <-handled:
+		if data != "plain" {
+			t.Fatalf("expected %q, got %q", "plain", data)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected the message to be handled")
+	}
+}